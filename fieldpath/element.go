@@ -38,8 +38,8 @@ type PathElement struct {
 	Key []value.Field
 
 	// Value selects the list element with the given value. The containing
-	// object must be an associative list with a primitive typed element
-	// (i.e., a set).
+	// object must be an associative list with a primitive or atomic typed
+	// element (i.e., a set).
 	Value *value.Value
 
 	// Index selects a list element by its index number. The containing
@@ -55,14 +55,14 @@ func (e PathElement) String() string {
 	case len(e.Key) > 0:
 		strs := make([]string, len(e.Key))
 		for i, k := range e.Key {
-			strs[i] = fmt.Sprintf("%v=%v", k.Name, k.Value.HumanReadable())
+			strs[i] = fmt.Sprintf("%v=%v", k.Name, k.Value.Canonical())
 		}
 		// The order must be canonical, since we use the string value
 		// in a set structure.
 		sort.Strings(strs)
 		return "[" + strings.Join(strs, ",") + "]"
 	case e.Value != nil:
-		return fmt.Sprintf("[=%v]", e.Value.HumanReadable())
+		return fmt.Sprintf("[=%v]", e.Value.Canonical())
 	case e.Index != nil:
 		return fmt.Sprintf("[%v]", *e.Index)
 	default:
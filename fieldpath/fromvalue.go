@@ -120,3 +120,49 @@ func GuessBestListPathElement(index int, item value.Value) PathElement {
 	}
 	return PathElement{Index: &index}
 }
+
+// GuessListKeys returns the names of the key fields that
+// GuessBestListPathElement finds in every item of the given lists, or nil if
+// the lists can't be treated as associative: some item has no key, items
+// disagree on the key fields, or two items of a list have the same key. Nil
+// lists are ignored.
+func GuessListKeys(lists ...*value.List) []string {
+	var keys []string
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		seen := map[string]struct{}{}
+		for i, item := range l.Items {
+			pe := GuessBestListPathElement(i, item)
+			if len(pe.Key) == 0 {
+				return nil
+			}
+			if keys == nil {
+				for _, f := range pe.Key {
+					keys = append(keys, f.Name)
+				}
+			} else if !sameKeyNames(keys, pe.Key) {
+				return nil
+			}
+			keyStr := pe.String()
+			if _, found := seen[keyStr]; found {
+				return nil
+			}
+			seen[keyStr] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func sameKeyNames(names []string, key []value.Field) bool {
+	if len(names) != len(key) {
+		return false
+	}
+	for i := range names {
+		if names[i] != key[i].Name {
+			return false
+		}
+	}
+	return true
+}
@@ -76,3 +76,38 @@ func TestFromValue(t *testing.T) {
 		})
 	}
 }
+
+func TestGuessListKeys(t *testing.T) {
+	table := []struct {
+		listsYAML []string
+		keys      []string
+	}{
+		{[]string{`[{"name":"a"},{"name":"b"}]`, `[{"name":"a"}]`}, []string{"name"}},
+		{[]string{`[{"name":"a","id":1},{"name":"a","id":2}]`}, []string{"id", "name"}},
+		{[]string{`[{"name":"a"},{"name":"a"}]`}, nil},
+		{[]string{`[{"name":"a"}]`, `[{"port":1}]`}, nil},
+		{[]string{`[{"name":"a"},{"value":1}]`}, nil},
+		{[]string{`[1,2]`}, nil},
+	}
+
+	for _, tt := range table {
+		var lists []*value.List
+		for _, y := range tt.listsYAML {
+			v, err := value.FromYAML([]byte(`{"l":` + y + `}`))
+			if err != nil {
+				t.Fatalf("unable to interpret yaml: %v\n%v", err, y)
+			}
+			lists = append(lists, v.Map.Items[0].Value.List)
+		}
+		got := GuessListKeys(append(lists, nil)...)
+		if len(got) != len(tt.keys) {
+			t.Errorf("%v: expected keys %v, got %v", tt.listsYAML, tt.keys, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.keys[i] {
+				t.Errorf("%v: expected keys %v, got %v", tt.listsYAML, tt.keys, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,442 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Compatibility says whether a schema change is safe for some use.
+type Compatibility string
+
+const (
+	Compatible = Compatibility("compatible")
+	Breaking   = Compatibility("breaking")
+)
+
+// SchemaChange describes a single difference between two versions of a
+// schema.
+type SchemaChange struct {
+	// TypeName is the named type in which the change was found.
+	TypeName string
+	// Path locates the change inside of the type: ".name" selects a struct
+	// field, "[]" the elements of a list and "{}" the values of a map. It is
+	// empty for changes to the type itself.
+	Path string
+	// Description explains the change.
+	Description string
+
+	// Validation is Breaking if objects which were valid according to the
+	// old schema may be invalid according to the new one.
+	Validation Compatibility
+	// Ownership is Breaking if field sets computed with the old schema may
+	// not refer to the same fields with the new one, e.g. because a list
+	// changed from atomic to associative.
+	Ownership Compatibility
+}
+
+// String returns a human readable description of the change.
+func (c SchemaChange) String() string {
+	return fmt.Sprintf("%v%v: %v (validation: %v, ownership: %v)",
+		c.TypeName, c.Path, c.Description, c.Validation, c.Ownership)
+}
+
+// CompatibilityReport lists the changes between two versions of a schema.
+type CompatibilityReport struct {
+	// Changes is sorted by type name and path.
+	Changes []SchemaChange
+}
+
+// Get returns the changes found at the given path of the given type.
+func (r *CompatibilityReport) Get(typeName, path string) []SchemaChange {
+	var out []SchemaChange
+	for _, c := range r.Changes {
+		if c.TypeName == typeName && c.Path == path {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// BreaksValidation returns true if any change is breaking for validation.
+func (r *CompatibilityReport) BreaksValidation() bool {
+	for _, c := range r.Changes {
+		if c.Validation == Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// BreaksOwnership returns true if any change is breaking for ownership
+// tracking.
+func (r *CompatibilityReport) BreaksOwnership() bool {
+	for _, c := range r.Changes {
+		if c.Ownership == Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCompatibility compares every named type of old with the type of the
+// same name in new, and reports the differences. Types which only exist in
+// new are not reported, since nothing can depend on them yet. References to
+// types of other schemas (see Registry) are followed, and those types are
+// compared where they're referenced.
+func CheckCompatibility(old, new *Schema) *CompatibilityReport {
+	c := compatChecker{
+		oldRoot: old,
+		newRoot: new,
+		old:     old,
+		new:     new,
+		visited: map[compatTypePair]bool{},
+	}
+	for _, t := range old.Types {
+		c.typeName = t.Name
+		nt, ok := new.FindNamedType(t.Name)
+		if !ok {
+			c.report("", "type was removed", Breaking, Breaking)
+			continue
+		}
+		c.compareAtoms("", t.Atom, nt.Atom)
+	}
+	sort.SliceStable(c.changes, func(i, j int) bool {
+		if c.changes[i].TypeName != c.changes[j].TypeName {
+			return c.changes[i].TypeName < c.changes[j].TypeName
+		}
+		return c.changes[i].Path < c.changes[j].Path
+	})
+	return &CompatibilityReport{Changes: c.changes}
+}
+
+type compatChecker struct {
+	// oldRoot and newRoot are the schemas being compared; old and new
+	// are the ones the types being compared are defined in, which differ
+	// when following references to other schemas of a Registry.
+	oldRoot, newRoot *Schema
+	old, new         *Schema
+	typeName         string
+	changes          []SchemaChange
+
+	// visited holds pairs of (old, new) types that are, or have been,
+	// compared inline; this stops recursive types.
+	visited map[compatTypePair]bool
+}
+
+// compatTypePair identifies a pair of named types, by the schemas they're
+// defined in and their names there.
+type compatTypePair struct {
+	old, new         *Schema
+	oldName, newName string
+}
+
+func (c *compatChecker) report(path, description string, validation, ownership Compatibility) {
+	c.changes = append(c.changes, SchemaChange{
+		TypeName:    c.typeName,
+		Path:        path,
+		Description: description,
+		Validation:  validation,
+		Ownership:   ownership,
+	})
+}
+
+func (c *compatChecker) compareTypeRefs(path string, old, new TypeRef) {
+	if old.NamedType != nil && new.NamedType != nil {
+		os, ot, oldOK := c.old.FindNamedTypeWithSchema(*old.NamedType)
+		ns, nt, newOK := c.new.FindNamedTypeWithSchema(*new.NamedType)
+		if oldOK && os == c.oldRoot && *old.NamedType == *new.NamedType {
+			// The named type is compared (and reported) on its own.
+			return
+		}
+		if oldOK && newOK && os == ns && ot.Name == nt.Name {
+			// The same type of a shared schema.
+			return
+		}
+		key := compatTypePair{os, ns, ot.Name, nt.Name}
+		if c.visited[key] {
+			return
+		}
+		c.visited[key] = true
+	}
+	os, oa, ok := c.old.ResolveWithSchema(old)
+	if !ok {
+		// The old schema was broken; there's nothing to compare.
+		return
+	}
+	ns, na, ok := c.new.ResolveWithSchema(new)
+	if !ok {
+		c.report(path, fmt.Sprintf("type %v was removed", *new.NamedType), Breaking, Breaking)
+		return
+	}
+	// References inside the atoms are relative to the schemas defining
+	// them.
+	oldScope, newScope := c.old, c.new
+	c.old, c.new = os, ns
+	c.compareAtoms(path, oa, na)
+	c.old, c.new = oldScope, newScope
+}
+
+func atomKind(a Atom) string {
+	switch {
+	case a.Scalar != nil:
+		return "scalar"
+	case a.Struct != nil:
+		return "struct"
+	case a.List != nil:
+		return "list"
+	case a.Map != nil:
+		return "map"
+	case a.Untyped != nil:
+		return "untyped"
+	}
+	return "invalid"
+}
+
+// isLeaf returns true if fields of the given type are always owned as a whole.
+func isLeaf(a Atom) bool {
+	switch {
+	case a.Scalar != nil:
+		return true
+	case a.Struct != nil:
+		return a.Struct.ElementRelationship == Atomic
+	case a.List != nil:
+		return a.List.ElementRelationship == Atomic
+	case a.Map != nil:
+		return a.Map.ElementRelationship == Atomic
+	case a.Untyped != nil:
+		return a.Untyped.ElementRelationship == "" || a.Untyped.ElementRelationship == Atomic
+	}
+	return false
+}
+
+func leafOwnership(old, new Atom) Compatibility {
+	if isLeaf(old) && isLeaf(new) {
+		return Compatible
+	}
+	return Breaking
+}
+
+func (c *compatChecker) compareAtoms(path string, old, new Atom) {
+	ok, nk := atomKind(old), atomKind(new)
+	if ok != nk {
+		validation := Breaking
+		if new.Untyped != nil {
+			// Untyped accepts anything.
+			validation = Compatible
+		}
+		c.report(path, fmt.Sprintf("changed from %v to %v", ok, nk), validation, leafOwnership(old, new))
+		return
+	}
+
+	if !reflect.DeepEqual(old.Constraints, new.Constraints) {
+		// Telling whether constraints were only loosened isn't worth
+		// the trouble, unless they were dropped entirely.
+		validation := Breaking
+		if new.Constraints == nil {
+			validation = Compatible
+		}
+		c.report(path, "constraints changed", validation, Compatible)
+	}
+	if !isImmutable(old) && isImmutable(new) {
+		// Updates which used to be accepted may now be rejected.
+		c.report(path, "became immutable", Breaking, Compatible)
+	}
+
+	switch {
+	case old.Scalar != nil:
+		c.compareScalars(path, *old.Scalar, *new.Scalar)
+	case old.Struct != nil:
+		c.compareStructs(path, old.Struct, new.Struct)
+	case old.List != nil:
+		c.compareLists(path, old.List, new.List)
+	case old.Map != nil:
+		c.compareMaps(path, old.Map, new.Map)
+	case old.Untyped != nil:
+		if old.Untyped.ElementRelationship != new.Untyped.ElementRelationship {
+			c.report(path, "untyped element relationship changed", Compatible, leafOwnership(old, new))
+		}
+	}
+}
+
+func isImmutable(a Atom) bool {
+	switch {
+	case a.Struct != nil:
+		return a.Struct.Immutable
+	case a.List != nil:
+		return a.List.Immutable
+	case a.Map != nil:
+		return a.Map.Immutable
+	}
+	return false
+}
+
+// scalarValueKinds lists the kinds of values accepted by a scalar type.
+func scalarValueKinds(s Scalar) map[string]bool {
+	kinds := map[string]bool{}
+	for _, k := range s.Kinds() {
+		switch k {
+		case Integer:
+			kinds["int"] = true
+		case Numeric, Float:
+			kinds["int"] = true
+			kinds["float"] = true
+		default:
+			kinds[string(k)] = true
+		}
+	}
+	return kinds
+}
+
+func (c *compatChecker) compareScalars(path string, old, new Scalar) {
+	if old == new {
+		return
+	}
+	newKinds := scalarValueKinds(new)
+	validation := Compatible
+	for k := range scalarValueKinds(old) {
+		if !newKinds[k] {
+			validation = Breaking
+		}
+	}
+	c.report(path, fmt.Sprintf("scalar changed from %v to %v", old, new), validation, Compatible)
+}
+
+func keyScalar(s Scalar) Scalar {
+	if s == "" {
+		return String
+	}
+	return s
+}
+
+func (c *compatChecker) compareStructs(path string, old, new *Struct) {
+	if (old.ElementRelationship == Atomic) != (new.ElementRelationship == Atomic) {
+		c.report(path, "struct element relationship changed", Compatible, Breaking)
+	}
+	if old.PreserveUnknownFields && !new.PreserveUnknownFields {
+		c.report(path, "unknown fields are no longer preserved", Breaking, Breaking)
+	}
+	oldFields := map[string]StructField{}
+	for _, f := range old.Fields {
+		oldFields[f.Name] = f
+	}
+	for _, nf := range new.Fields {
+		if !nf.Required {
+			continue
+		}
+		existed := false
+		for _, name := range append([]string{nf.Name}, nf.FormerNames...) {
+			if _, ok := oldFields[name]; ok {
+				existed = true
+			}
+		}
+		if !existed {
+			c.report(path+"."+nf.Name, "required field was added", Breaking, Compatible)
+		}
+	}
+
+	// New fields are found by their current name, or by a former name if
+	// they were renamed.
+	newFields := map[string]StructField{}
+	for _, f := range new.Fields {
+		for _, name := range f.FormerNames {
+			newFields[name] = f
+		}
+	}
+	for _, f := range new.Fields {
+		newFields[f.Name] = f
+	}
+	for _, of := range old.Fields {
+		fieldPath := path + "." + of.Name
+		nf, ok := newFields[of.Name]
+		if !ok {
+			c.report(fieldPath, "field was removed", Breaking, Breaking)
+			continue
+		}
+		if nf.Name != of.Name {
+			// Values and field sets which use the old name are
+			// still understood.
+			c.report(fieldPath, "field was renamed to "+nf.Name, Compatible, Compatible)
+		}
+		for _, name := range of.FormerNames {
+			if name != nf.Name && !hasName(nf.FormerNames, name) {
+				c.report(fieldPath, fmt.Sprintf("former name %q was dropped", name), Breaking, Breaking)
+			}
+		}
+		if nf.Required && !of.Required {
+			c.report(fieldPath, "field became required", Breaking, Compatible)
+		}
+		if nf.Nullable != nil && !*nf.Nullable && (of.Nullable == nil || *of.Nullable) {
+			c.report(fieldPath, "field became non-nullable", Breaking, Compatible)
+		}
+		if nf.Immutable && !of.Immutable {
+			c.report(fieldPath, "field became immutable", Breaking, Compatible)
+		}
+		c.compareTypeRefs(fieldPath, of.Type, nf.Type)
+	}
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compatChecker) compareLists(path string, old, new *List) {
+	switch {
+	case old.ElementRelationship != new.ElementRelationship:
+		// Making a list associative may make existing objects invalid
+		// (e.g. because of duplicates); making it atomic or positional
+		// can't.
+		validation := Breaking
+		if new.ElementRelationship == Atomic || new.ElementRelationship == Positional {
+			validation = Compatible
+		}
+		c.report(path, fmt.Sprintf("list changed from %v to %v", old.ElementRelationship, new.ElementRelationship), validation, Breaking)
+	case !reflect.DeepEqual(old.Keys, new.Keys):
+		c.report(path, fmt.Sprintf("list keys changed from %v to %v", old.Keys, new.Keys), Breaking, Breaking)
+	}
+	c.compareTypeRefs(path+"[]", old.ElementType, new.ElementType)
+}
+
+func (c *compatChecker) compareMaps(path string, old, new *Map) {
+	if (old.ElementRelationship == Atomic) != (new.ElementRelationship == Atomic) {
+		c.report(path, "map element relationship changed", Compatible, Breaking)
+	}
+	if keyScalar(old.KeyType) != keyScalar(new.KeyType) {
+		// Keys are canonicalized differently for each type, so even
+		// widening the type may change the paths of existing entries.
+		validation := Compatible
+		newKinds := scalarValueKinds(keyScalar(new.KeyType))
+		for k := range scalarValueKinds(keyScalar(old.KeyType)) {
+			if !newKinds[k] {
+				validation = Breaking
+			}
+		}
+		if keyScalar(new.KeyType) == String {
+			// Any key is a valid string.
+			validation = Compatible
+		}
+		c.report(path, fmt.Sprintf("map key type changed from %v to %v", keyScalar(old.KeyType), keyScalar(new.KeyType)), validation, Breaking)
+	}
+	c.compareTypeRefs(path+"{}", old.ElementType, new.ElementType)
+}
@@ -0,0 +1,438 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"testing"
+)
+
+var compatOldSchema = `types:
+- name: root
+  struct:
+    fields:
+    - name: removed
+      type:
+        scalar: string
+    - name: widened
+      type:
+        scalar: integer
+    - name: narrowed
+      type:
+        scalar: numeric
+    - name: retyped
+      type:
+        scalar: string
+    - name: loosened
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+    - name: set
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: unset
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+    - name: rekeyed
+      type:
+        list:
+          elementType:
+            namedType: item
+          elementRelationship: associative
+          keys:
+          - name
+    - name: atomicMap
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: recursive
+      type:
+        namedType: node
+    - name: optional
+      type:
+        scalar: string
+    - name: constrained
+      type:
+        scalar: string
+        constraints:
+          maxLength: 10
+    - name: intKeys
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: integer
+    - name: closed
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+          preserveUnknownFields: true
+    - name: oldName
+      type:
+        scalar: string
+      required: true
+    - name: aliased
+      type:
+        scalar: string
+      formerNames:
+      - alias
+    - name: frozen
+      type:
+        scalar: string
+    - name: frozenList
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: port
+      type:
+        scalar: integer
+    - name: target
+      type:
+        scalar: integer|string
+    - name: steps
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: shuffled
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+- name: item
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: protocol
+      type:
+        scalar: string
+- name: node
+  struct:
+    fields:
+    - name: children
+      type:
+        list:
+          elementType:
+            namedType: node
+          elementRelationship: atomic
+    - name: value
+      type:
+        scalar: string
+- name: gone
+  scalar: string
+`
+
+var compatNewSchema = `types:
+- name: root
+  struct:
+    fields:
+    - name: widened
+      type:
+        scalar: float
+    - name: narrowed
+      type:
+        scalar: integer
+    - name: retyped
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+    - name: loosened
+      type:
+        untyped: {}
+    - name: set
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+    - name: unset
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: rekeyed
+      type:
+        list:
+          elementType:
+            namedType: item
+          elementRelationship: associative
+          keys:
+          - name
+          - protocol
+    - name: atomicMap
+      type:
+        map:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: recursive
+      type:
+        namedType: node
+    - name: added
+      type:
+        scalar: string
+    - name: constrained
+      type:
+        scalar: string
+        constraints:
+          maxLength: 5
+    - name: intKeys
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: closed
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+    - name: addedRequired
+      type:
+        scalar: string
+      required: true
+    - name: optional
+      type:
+        scalar: string
+      required: true
+      nullable: false
+    - name: newName
+      type:
+        scalar: string
+      required: true
+      formerNames:
+      - oldName
+    - name: aliased
+      type:
+        scalar: string
+    - name: frozen
+      type:
+        scalar: string
+      immutable: true
+    - name: frozenList
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+          immutable: true
+    - name: port
+      type:
+        scalar: integer|string
+    - name: target
+      type:
+        scalar: integer
+    - name: steps
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: shuffled
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+- name: item
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: protocol
+      type:
+        scalar: string
+- name: node
+  struct:
+    fields:
+    - name: children
+      type:
+        list:
+          elementType:
+            namedType: node
+          elementRelationship: atomic
+    - name: value
+      type:
+        scalar: integer
+`
+
+func TestCheckCompatibility(t *testing.T) {
+	old := mustParseSchema(t, compatOldSchema)
+	new := mustParseSchema(t, compatNewSchema)
+
+	r := CheckCompatibility(old, new)
+	for _, c := range r.Changes {
+		t.Logf("%v", c)
+	}
+
+	expect := []struct {
+		typeName, path        string
+		validation, ownership Compatibility
+	}{
+		{"gone", "", Breaking, Breaking},
+		{"node", ".value", Breaking, Compatible},
+		{"root", ".addedRequired", Breaking, Compatible},
+		{"root", ".aliased", Breaking, Breaking},
+		{"root", ".atomicMap", Compatible, Breaking},
+		{"root", ".closed", Breaking, Breaking},
+		{"root", ".constrained", Breaking, Compatible},
+		{"root", ".frozen", Breaking, Compatible},
+		{"root", ".frozenList", Breaking, Compatible},
+		{"root", ".intKeys", Compatible, Breaking},
+		{"root", ".loosened", Compatible, Breaking},
+		{"root", ".narrowed", Breaking, Compatible},
+		{"root", ".oldName", Compatible, Compatible},
+		{"root", ".optional", Breaking, Compatible},
+		{"root", ".optional", Breaking, Compatible},
+		{"root", ".port", Compatible, Compatible},
+		{"root", ".rekeyed", Breaking, Breaking},
+		{"root", ".removed", Breaking, Breaking},
+		{"root", ".retyped", Breaking, Breaking},
+		{"root", ".set", Breaking, Breaking},
+		{"root", ".shuffled", Breaking, Breaking},
+		{"root", ".steps", Compatible, Breaking},
+		{"root", ".target", Breaking, Compatible},
+		{"root", ".unset", Compatible, Breaking},
+		{"root", ".widened", Compatible, Compatible},
+	}
+	if len(r.Changes) != len(expect) {
+		t.Fatalf("expected %v changes, got %v", len(expect), len(r.Changes))
+	}
+	for i, e := range expect {
+		got := r.Changes[i]
+		if got.TypeName != e.typeName || got.Path != e.path || got.Validation != e.validation || got.Ownership != e.ownership {
+			t.Errorf("expected change %v to be %v%v (validation: %v, ownership: %v), got %v",
+				i, e.typeName, e.path, e.validation, e.ownership, got)
+		}
+		if len(r.Get(e.typeName, e.path)) == 0 {
+			t.Errorf("expected to get changes for %v%v", e.typeName, e.path)
+		}
+	}
+	if !r.BreaksValidation() || !r.BreaksOwnership() {
+		t.Errorf("expected the report to be breaking")
+	}
+
+	if r := CheckCompatibility(old, old); len(r.Changes) != 0 || r.BreaksValidation() || r.BreaksOwnership() {
+		t.Errorf("expected no changes comparing a schema with itself, got %v", r.Changes)
+	}
+}
+
+func TestCheckCompatibilityCrossSchema(t *testing.T) {
+	old := mustParseSchema(t, `package: apps
+types:
+- name: deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: ObjectMeta
+    - name: status
+      type:
+        namedType: meta.Status
+- name: ObjectMeta
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+`)
+	oldMeta := mustParseSchema(t, `package: meta
+types:
+- name: Status
+  struct:
+    fields:
+    - name: phase
+      type:
+        scalar: string
+`)
+	new := mustParseSchema(t, `package: apps
+types:
+- name: deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: meta.ObjectMeta
+    - name: status
+      type:
+        namedType: meta.Status
+`)
+	newMeta := mustParseSchema(t, `package: meta
+types:
+- name: ObjectMeta
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+- name: Status
+  struct:
+    fields:
+    - name: phase
+      type:
+        scalar: integer
+`)
+	if _, err := NewRegistry(old, oldMeta); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewRegistry(new, newMeta); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := CheckCompatibility(old, new)
+	for _, c := range r.Changes {
+		t.Logf("%v", c)
+	}
+	// The local ObjectMeta is gone, but the field's type is the same.
+	if len(r.Get("ObjectMeta", "")) != 1 {
+		t.Errorf("expected the removal of ObjectMeta to be reported")
+	}
+	if changes := r.Get("deployment", ".metadata"); len(changes) != 0 {
+		t.Errorf("expected no changes to the metadata field, got %v", changes)
+	}
+	// Types of other schemas are compared too.
+	if changes := r.Get("deployment", ".status.phase"); len(changes) != 1 || changes[0].Validation != Breaking {
+		t.Errorf("expected a breaking change to the status phase, got %v", changes)
+	}
+	if len(r.Changes) != 2 {
+		t.Errorf("expected 2 changes, got %v", r.Changes)
+	}
+}
@@ -16,9 +16,20 @@ limitations under the License.
 
 package schema
 
+import (
+	"strings"
+)
+
 // Schema is a list of types.
 type Schema struct {
 	Types []TypeDef `yaml:"types,omitempty"`
+
+	// Package names the schema within a Registry; it's only required for
+	// schemas which are added to one.
+	Package string `yaml:"package,omitempty"`
+
+	// registry is set when the schema is added to a Registry.
+	registry *Registry
 }
 
 // A TypeSpecifier references a particular type in a schema.
@@ -50,15 +61,71 @@ type Atom struct {
 	*List    `yaml:"list,omitempty"`
 	*Map     `yaml:"map,omitempty"`
 	*Untyped `yaml:"untyped,omitempty"`
+
+	// Constraints optionally restrict the values accepted by the above.
+	Constraints *Constraints `yaml:"constraints,omitempty"`
+}
+
+// Constraints restrict the values of a type beyond what its kind allows. Each
+// constraint only applies to values of the relevant kind, e.g. Pattern is
+// ignored for numbers. They are checked by validation, but not by merging,
+// except for Format.
+type Constraints struct {
+	// Format names the format of a scalar's values, e.g. `quantity` (see
+	// typed.RegisterFormat). Values must parse according to the format,
+	// and values which mean the same thing (e.g. the durations "1m" and
+	// "60s") are considered equal when comparing objects. Formats which
+	// aren't registered are ignored.
+	Format string `yaml:"format,omitempty"`
+
+	// Enum lists the allowed values of a scalar, in unstructured form (see
+	// value.FromUnstructured).
+	Enum []interface{} `yaml:"enum,omitempty"`
+	// Pattern is a regular expression (Go syntax) that strings must match.
+	Pattern string `yaml:"pattern,omitempty"`
+	// MinLength and MaxLength bound the length of strings, in characters.
+	MinLength *int64 `yaml:"minLength,omitempty"`
+	MaxLength *int64 `yaml:"maxLength,omitempty"`
+	// Minimum and Maximum bound numbers (inclusively).
+	Minimum *float64 `yaml:"minimum,omitempty"`
+	Maximum *float64 `yaml:"maximum,omitempty"`
+	// MultipleOf requires numbers to be a multiple of it.
+	MultipleOf *float64 `yaml:"multipleOf,omitempty"`
+
+	// MinItems and MaxItems bound the number of items in lists.
+	MinItems *int64 `yaml:"minItems,omitempty"`
+	MaxItems *int64 `yaml:"maxItems,omitempty"`
+	// MaxProperties bounds the number of items in maps.
+	MaxProperties *int64 `yaml:"maxProperties,omitempty"`
 }
 
 // Scalar (AKA "primitive") has a single value which is either numeric, string,
-// or boolean.
-// TODO: split numeric into float/int? Something even more fine-grained?
+// or boolean. Numeric values may be further restricted to integers or floats.
+//
+// A scalar may also accept several kinds of values, separated by "|", e.g.
+// `integer|string` for Kubernetes' IntOrString. Values of different kinds
+// are never equal; changing from one to another is a modification.
 type Scalar string
 
+// Kinds returns the kinds of values s accepts: s itself, or the members of a
+// union.
+func (s Scalar) Kinds() []Scalar {
+	var kinds []Scalar
+	for _, k := range strings.Split(string(s), "|") {
+		kinds = append(kinds, Scalar(k))
+	}
+	return kinds
+}
+
 const (
+	// Numeric accepts any number; it is an alias for "integer or float".
 	Numeric = Scalar("numeric")
+	// Integer accepts whole numbers only. Floats with no fractional part
+	// (e.g. 1.0) are accepted, since many serializers can't tell them
+	// apart.
+	Integer = Scalar("integer")
+	// Float accepts any number, integers included.
+	Float   = Scalar("float")
 	String  = Scalar("string")
 	Boolean = Scalar("boolean")
 )
@@ -76,13 +143,20 @@ const (
 	// Separable means the items of the container type have no particular
 	// relationship (default behavior for maps and structs).
 	Separable = ElementRelationship("separable")
+	// Positional only applies to lists (see the documentation there).
+	Positional = ElementRelationship("positional")
+	// Guess and Lookup only apply to untyped data (see the documentation
+	// there).
+	Guess  = ElementRelationship("guess")
+	Lookup = ElementRelationship("lookup")
 )
 
 // Struct is a list of fields. Each field has a name and a type. Some fields
 // may be grouped into unions.
 type Struct struct {
 	// Each struct field appears exactly once in this list. The order in
-	// this list defines the canonical field ordering.
+	// this list defines the canonical field ordering, which normalized
+	// objects follow.
 	Fields []StructField `yaml:"fields,omitempty"`
 
 	// TODO: Implement unions, either this way or by inlining.
@@ -101,6 +175,15 @@ type Struct struct {
 	// The default behavior for structs is `separable`; it's permitted to
 	// leave this unset to get the default behavior.
 	ElementRelationship ElementRelationship `yaml:"elementRelationship,omitempty"`
+
+	// PreserveUnknownFields makes the struct accept fields which aren't in
+	// Fields, rather than rejecting them. They are treated as atomic
+	// untyped data.
+	PreserveUnknownFields bool `yaml:"preserveUnknownFields,omitempty"`
+
+	// Immutable makes every value of the struct immutable, like
+	// StructField.Immutable. Only atomic structs may be immutable.
+	Immutable bool `yaml:"immutable,omitempty"`
 }
 
 // StructField pairs a field name with a field type.
@@ -109,6 +192,32 @@ type StructField struct {
 	Name string `yaml:"name,omitempty"`
 	// Type is the field type.
 	Type TypeRef `yaml:"type,omitempty"`
+	// Default is the value of the field if it is omitted, in unstructured
+	// form (see value.FromUnstructured). Defaults are applied by
+	// TypedValue.Default(), and must be valid values of the field's type;
+	// Default() fails on those which aren't.
+	Default interface{} `yaml:"default,omitempty"`
+
+	// Required fields must be present in valid objects. Validation of
+	// partially specified objects (e.g. by Merge) doesn't check this.
+	Required bool `yaml:"required,omitempty"`
+	// Nullable says whether the field may be an explicit null. If unset,
+	// it's up to the type: nulls are accepted for structs, lists, maps and
+	// untyped data, but not for scalars. If set, it overrides the type.
+	Nullable *bool `yaml:"nullable,omitempty"`
+
+	// FormerNames lists the names the field had in earlier versions of
+	// the schema. A value found under a former name is treated as if it
+	// used the current name: it is validated, owned and merged under the
+	// current name, and merging renames it. Objects may only use one of
+	// the names of a field.
+	FormerNames []string `yaml:"formerNames,omitempty"`
+
+	// Immutable fields may be set once, but not changed afterwards. This
+	// is only checked by TypedValue.Merge() and Compare() when asked to
+	// (see typed.EnforceImmutability). Every field nested in an immutable
+	// field is immutable too.
+	Immutable bool `yaml:"immutable,omitempty"`
 }
 
 /*
@@ -152,7 +261,17 @@ type List struct {
 	// * `associative`:
 	//   - If the list element is a scalar, the list is treated as a set.
 	//   - If the list element is a struct, the list is treated as a map.
-	//   - The list element must not be a map or a list itself.
+	//   - If the list element is an atomic map, list or struct, the list
+	//     is treated as a set of those values.
+	//   - The list element must not be a non-atomic map or list itself.
+	// * `positional`: the list is merged item by item, by index, and each
+	//   index is owned separately (its path element is an Index). Items
+	//   beyond the end of the lhs are appended. Compare reports the
+	//   indices past the end of the rhs as removed, but, like any other
+	//   removed field, they're kept in the merged value; the list is only
+	//   truncated by nulls at its end, when merging with typed.DeleteNulls.
+	//   Inserting an item anywhere but at the end changes every item after
+	//   it.
 	// There is no default for this value for lists; all schemas must
 	// explicitly state the element relationship for all lists.
 	ElementRelationship ElementRelationship `yaml:"elementRelationship,omitempty"`
@@ -164,19 +283,37 @@ type List struct {
 	//
 	// TODO: change this to "non-atomic struct" above and make the code reflect this.
 	//
-	// Each key must refer to a single field name (no nesting, not JSONPath).
+	// Each key is a field name, or a dot-separated path of field names
+	// selecting a field of a nested struct (e.g. "port.number"; this is
+	// not JSONPath). If an element omits a key field which has a Default,
+	// the default is used as the key; other key fields are required.
 	Keys []string `yaml:"keys,omitempty"`
+
+	// ElementDefault, if set, replaces null elements of the list when
+	// defaulting. It's in unstructured form, like StructField.Default.
+	ElementDefault interface{} `yaml:"elementDefault,omitempty"`
+
+	// Immutable makes every value of the list immutable, like
+	// StructField.Immutable. Only atomic lists may be immutable.
+	Immutable bool `yaml:"immutable,omitempty"`
 }
 
 // Map is a key-value pair. Its semantics are the same as an associative list, but:
 // * It is serialized differently:
 //     map:  {"k": {"value": "v"}}
 //     list: [{"key": "k", "value": "v"}]
-// * Keys must be string typed.
+// * Keys are serialized as strings, but may hold other scalar types (see
+//   KeyType).
 // * Keys can't have multiple components.
 type Map struct {
 	ElementType TypeRef `yaml:"elementType,omitempty"`
 
+	// KeyType is the type of the map's keys; the default is `string`. Keys
+	// of other types must parse as such (e.g. "1" for `integer`), and are
+	// canonicalized ("01" and "1" are the same key), so that ownership of
+	// an entry doesn't depend on how its key was spelled.
+	KeyType Scalar `yaml:"keyType,omitempty"`
+
 	// ElementRelationship states the relationship between the map's items.
 	// * `separable` implies that each element is 100% independent.
 	// * `atomic` implies that all elements depend on each other, and this
@@ -186,6 +323,14 @@ type Map struct {
 	// The default behavior for maps is `separable`; it's permitted to
 	// leave this unset to get the default behavior.
 	ElementRelationship ElementRelationship `yaml:"elementRelationship,omitempty"`
+
+	// ElementDefault, if set, replaces null values of the map when
+	// defaulting. It's in unstructured form, like StructField.Default.
+	ElementDefault interface{} `yaml:"elementDefault,omitempty"`
+
+	// Immutable makes every value of the map immutable, like
+	// StructField.Immutable. Only atomic maps may be immutable.
+	Immutable bool `yaml:"immutable,omitempty"`
 }
 
 // Untyped is used for fields that allow arbitrary content. (Think: plugin
@@ -196,9 +341,13 @@ type Untyped struct {
 	// * `atomic` implies that all elements depend on each other, and this
 	//   is effectively a scalar / leaf field; it doesn't make sense for
 	//   separate actors to set the elements.
-	// TODO: support "guess" (guesses at associative list keys)
-	// TODO: support "lookup" (calls a lookup function to figure out the
-	//       schema based on the data)
+	// * `guess` makes maps separable, and lists associative if all of
+	//   their items are maps which can be keyed by the same fields from
+	//   fieldpath.AssociativeListCandidateFieldNames. Everything else is
+	//   atomic. This applies recursively to the items.
+	// * `lookup` calls a function (provided at runtime, since it can't be
+	//   serialized) to figure out the type of the data, for example from
+	//   its apiVersion and kind fields.
 	// The default behavior for untyped data is `atomic`; it's permitted to
 	// leave this unset to get the default behavior.
 	ElementRelationship ElementRelationship `yaml:"elementRelationship,omitempty"`
@@ -229,3 +378,35 @@ func (s Schema) Resolve(tr TypeRef) (Atom, bool) {
 	}
 	return tr.Inlined, true
 }
+
+// ResolveWithSchema is like Resolve, but also follows package-qualified
+// references to types of other schemas in the same Registry. It returns the
+// schema the atom was found in, since any references inside the atom are
+// relative to that schema. A nil schema only resolves inlined types.
+func (s *Schema) ResolveWithSchema(tr TypeRef) (*Schema, Atom, bool) {
+	if tr.NamedType == nil {
+		return s, tr.Inlined, true
+	}
+	s2, t, ok := s.FindNamedTypeWithSchema(*tr.NamedType)
+	if !ok {
+		return nil, Atom{}, false
+	}
+	return s2, t.Atom, true
+}
+
+// FindNamedTypeWithSchema is like FindNamedType, but also follows
+// package-qualified names of types of other schemas in the same Registry. It
+// returns the schema the type was found in; the TypeDef has the type's name
+// in that schema.
+func (s *Schema) FindNamedTypeWithSchema(name string) (*Schema, TypeDef, bool) {
+	if s == nil {
+		return nil, TypeDef{}, false
+	}
+	if t, ok := s.FindNamedType(name); ok {
+		return s, t, true
+	}
+	if s.registry == nil {
+		return nil, TypeDef{}, false
+	}
+	return s.registry.findQualifiedType(name)
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FromGoTypes creates a Schema describing the given Go types. Every named
+// struct type reachable from the inputs gets a TypeDef, named after its
+// package-qualified Go name (e.g. "k8s.io/api/core/v1.PodSpec"); everything
+// else is inlined.
+//
+// Struct fields are named after their `json` tag, following the rules of
+// encoding/json: unexported fields and fields tagged "-" are skipped, and
+// embedded structs without a name have their fields promoted. A promoted
+// field is shadowed by any field of the same name at a shallower depth; at
+// the same depth, a tagged field wins, and if that doesn't settle it, no
+// field gets the name.
+//
+// Types which serialize themselves are typed by what they can produce: a
+// json.Marshaler (such as json.RawMessage) is untyped, unless it's also an
+// encoding.TextMarshaler (such as time.Time), in which case it's assumed to
+// produce a string, as do other encoding.TextMarshalers. Byte slices are
+// base64 strings, but byte arrays are lists of integers.
+//
+// Go comments aren't available at runtime, so the markers that would usually
+// be written as comments are read from the `schema` struct tag instead, as a
+// comma separated list:
+//  * `listType=atomic|set|map|positional` (default atomic)
+//  * `listMapKey=<field>` (may be repeated; required for listType=map)
+//  * `mapType=atomic|granular` (default granular)
+//  * `structType=atomic|granular` (only for inlined structs)
+// For example:
+//
+//	Ports []Port `json:"ports" schema:"listType=map,listMapKey=name"`
+func FromGoTypes(types ...reflect.Type) (*Schema, error) {
+	b := goTypeBuilder{
+		schema: &Schema{},
+		seen:   map[reflect.Type]string{},
+	}
+	for _, t := range types {
+		if _, err := b.typeRef(t, nil); err != nil {
+			return nil, err
+		}
+	}
+	return b.schema, nil
+}
+
+// GoTypeName returns the name FromGoTypes uses for t's TypeDef.
+func GoTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+type goTypeBuilder struct {
+	schema *Schema
+	// seen maps named struct types to the name of their TypeDef. Types
+	// are added before their fields are visited, so that recursive types
+	// terminate.
+	seen map[reflect.Type]string
+}
+
+// markers holds the parsed contents of a `schema` struct tag.
+type markers struct {
+	listType    string
+	listMapKeys []string
+	mapType     string
+	structType  string
+}
+
+func parseMarkers(tag string) (*markers, error) {
+	m := &markers{}
+	if tag == "" {
+		return m, nil
+	}
+	for _, part := range strings.Split(tag, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("marker %q must have the form key=value", part)
+		}
+		switch kv[0] {
+		case "listType":
+			m.listType = kv[1]
+		case "listMapKey":
+			m.listMapKeys = append(m.listMapKeys, kv[1])
+		case "mapType":
+			m.mapType = kv[1]
+		case "structType":
+			m.structType = kv[1]
+		default:
+			return nil, fmt.Errorf("unknown marker %q", kv[0])
+		}
+	}
+	return m, nil
+}
+
+func (b *goTypeBuilder) typeRef(t reflect.Type, m *markers) (TypeRef, error) {
+	if m == nil {
+		m = &markers{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	jsonMarshaler := implements(t, jsonMarshalerType)
+	textMarshaler := implements(t, textMarshalerType)
+	switch {
+	case jsonMarshaler && !textMarshaler:
+		// Anything could come out of it.
+		return TypeRef{Inlined: Atom{Untyped: &Untyped{}}}, nil
+	case textMarshaler:
+		return scalarRef(String), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return scalarRef(Boolean), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return scalarRef(Integer), nil
+	case reflect.Float32, reflect.Float64:
+		return scalarRef(Float), nil
+	case reflect.String:
+		return scalarRef(String), nil
+	case reflect.Interface:
+		return TypeRef{Inlined: Atom{Untyped: &Untyped{}}}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json serializes []byte as a base64 string.
+			return scalarRef(String), nil
+		}
+		return b.listRef(t, m)
+	case reflect.Map:
+		return b.mapRef(t, m)
+	case reflect.Struct:
+		return b.structRef(t, m)
+	}
+	return TypeRef{}, fmt.Errorf("%v: unsupported kind %v", t, t.Kind())
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// implements reports whether t, or a pointer to it, implements iface.
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func scalarRef(s Scalar) TypeRef {
+	return TypeRef{Inlined: Atom{Scalar: &s}}
+}
+
+func (b *goTypeBuilder) listRef(t reflect.Type, m *markers) (TypeRef, error) {
+	elem, err := b.typeRef(t.Elem(), nil)
+	if err != nil {
+		return TypeRef{}, err
+	}
+	l := &List{ElementType: elem}
+	switch m.listType {
+	case "", "atomic":
+		l.ElementRelationship = Atomic
+	case "set":
+		l.ElementRelationship = Associative
+	case "positional":
+		l.ElementRelationship = Positional
+	case "map":
+		if len(m.listMapKeys) == 0 {
+			return TypeRef{}, fmt.Errorf("%v: listType=map requires at least one listMapKey", t)
+		}
+		l.ElementRelationship = Associative
+		l.Keys = m.listMapKeys
+	default:
+		return TypeRef{}, fmt.Errorf("%v: unknown listType %q", t, m.listType)
+	}
+	return TypeRef{Inlined: Atom{List: l}}, nil
+}
+
+func (b *goTypeBuilder) mapRef(t reflect.Type, m *markers) (TypeRef, error) {
+	// encoding/json serializes integer keys as strings; other kinds of
+	// keys aren't supported.
+	var keyType Scalar
+	switch t.Key().Kind() {
+	case reflect.String:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		keyType = Integer
+	default:
+		return TypeRef{}, fmt.Errorf("%v: map keys must be strings or integers", t)
+	}
+	elem, err := b.typeRef(t.Elem(), nil)
+	if err != nil {
+		return TypeRef{}, err
+	}
+	mt := &Map{ElementType: elem, KeyType: keyType}
+	switch m.mapType {
+	case "", "granular":
+	case "atomic":
+		mt.ElementRelationship = Atomic
+	default:
+		return TypeRef{}, fmt.Errorf("%v: unknown mapType %q", t, m.mapType)
+	}
+	return TypeRef{Inlined: Atom{Map: mt}}, nil
+}
+
+func (b *goTypeBuilder) structRef(t reflect.Type, m *markers) (TypeRef, error) {
+	var er ElementRelationship
+	switch m.structType {
+	case "", "granular":
+	case "atomic":
+		er = Atomic
+	default:
+		return TypeRef{}, fmt.Errorf("%v: unknown structType %q", t, m.structType)
+	}
+
+	if t.Name() == "" {
+		st, err := b.structType(t)
+		if err != nil {
+			return TypeRef{}, err
+		}
+		st.ElementRelationship = er
+		return TypeRef{Inlined: Atom{Struct: st}}, nil
+	}
+	if er != "" {
+		return TypeRef{}, fmt.Errorf("%v: structType can only be set on anonymous structs", t)
+	}
+
+	if name, ok := b.seen[t]; ok {
+		return TypeRef{NamedType: &name}, nil
+	}
+	name := GoTypeName(t)
+	b.seen[t] = name
+	// Reserve the slot before recursing so the order of Types follows
+	// the order in which types are first mentioned.
+	index := len(b.schema.Types)
+	b.schema.Types = append(b.schema.Types, TypeDef{Name: name})
+	st, err := b.structType(t)
+	if err != nil {
+		return TypeRef{}, err
+	}
+	b.schema.Types[index].Atom = Atom{Struct: st}
+	return TypeRef{NamedType: &name}, nil
+}
+
+func (b *goTypeBuilder) structType(t reflect.Type) (*Struct, error) {
+	st := &Struct{}
+	if err := b.addStructFields(st, t); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// goField is a struct field as encoding/json sees it, possibly promoted from
+// an embedded struct.
+type goField struct {
+	name   string
+	tagged bool
+	// index is the path of field indices from the outer struct, as in
+	// reflect.Type.FieldByIndex; its length is the depth of the field.
+	index []int
+	owner reflect.Type
+	field reflect.StructField
+}
+
+func (b *goTypeBuilder) addStructFields(st *Struct, t reflect.Type) error {
+	byName := map[string][]goField{}
+	var names []string
+	for _, f := range goFields(t, nil, map[reflect.Type]bool{}) {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []goField
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			fields = append(fields, f)
+		}
+	}
+	// Fields are in the order encoding/json writes them.
+	sort.Slice(fields, func(i, j int) bool {
+		return indexLess(fields[i].index, fields[j].index)
+	})
+
+	for _, f := range fields {
+		m, err := parseMarkers(f.field.Tag.Get("schema"))
+		if err != nil {
+			return fmt.Errorf("%v.%v: %v", f.owner, f.field.Name, err)
+		}
+		tr, err := b.typeRef(f.field.Type, m)
+		if err != nil {
+			return fmt.Errorf("%v.%v: %v", f.owner, f.field.Name, err)
+		}
+		st.Fields = append(st.Fields, StructField{Name: f.name, Type: tr})
+	}
+	return nil
+}
+
+// goFields lists the fields of t, promoting the fields of embedded structs,
+// in depth first order. visiting holds the embedded structs being listed, so
+// that embedding cycles terminate.
+func goFields(t reflect.Type, index []int, visiting map[reflect.Type]bool) []goField {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var fields []goField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		jsonTag := f.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.PkgPath != "" && !(f.Anonymous && ft.Kind() == reflect.Struct) {
+			// unexported
+			continue
+		}
+		fi := append(append([]int{}, index...), i)
+		name := strings.Split(jsonTag, ",")[0]
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if !visiting[ft] {
+				fields = append(fields, goFields(ft, fi, visiting)...)
+			}
+			continue
+		}
+		tagged := name != ""
+		if !tagged {
+			name = f.Name
+		}
+		fields = append(fields, goField{name: name, tagged: tagged, index: fi, owner: t, field: f})
+	}
+	return fields
+}
+
+// dominantField picks the field which gets a name, among the fields which
+// have it: the shallowest, or the tagged one among the shallowest. It returns
+// false if that's ambiguous.
+func dominantField(fields []goField) (goField, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields {
+		if len(f.index) < depth {
+			depth = len(f.index)
+		}
+	}
+	var shallowest, tagged []goField
+	for _, f := range fields {
+		if len(f.index) != depth {
+			continue
+		}
+		shallowest = append(shallowest, f)
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	switch {
+	case len(shallowest) == 1:
+		return shallowest[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	}
+	return goField{}, false
+}
+
+func indexLess(lhs, rhs []int) bool {
+	for i := range lhs {
+		if i >= len(rhs) {
+			return false
+		}
+		if lhs[i] != rhs[i] {
+			return lhs[i] < rhs[i]
+		}
+	}
+	return len(lhs) < len(rhs)
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type testPort struct {
+	Name     string `json:"name"`
+	Number   int32  `json:"number,omitempty"`
+	Protocol string `json:"protocol"`
+}
+
+type testMeta struct {
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type testNode struct {
+	testMeta `json:",inline"`
+
+	Ports    []testPort             `json:"ports" schema:"listType=map,listMapKey=name,listMapKey=protocol"`
+	Tags     []string               `json:"tags" schema:"listType=set"`
+	Args     []string               `json:"args"`
+	Command  []string               `json:"command" schema:"listType=positional"`
+	Env      map[string]string      `json:"env" schema:"mapType=atomic"`
+	Weights  map[uint16]float64     `json:"weights"`
+	Children []*testNode            `json:"children"`
+	Parent   *testNode              `json:"parent,omitempty"`
+	Color    struct{ R, G, B int }  `json:"color" schema:"structType=atomic"`
+	Extra    map[string]interface{} `json:"extra"`
+	Data     []byte                 `json:"data"`
+	Weight   float64                `json:"weight"`
+	Enabled  bool                   `json:"enabled"`
+	Ignored  string                 `json:"-"`
+	internal string
+}
+
+func TestFromGoTypes(t *testing.T) {
+	s, err := FromGoTypes(reflect.TypeOf(testNode{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nodeName := GoTypeName(reflect.TypeOf(testNode{}))
+	portName := GoTypeName(reflect.TypeOf(testPort{}))
+	expectYAML := `types:
+- name: ` + nodeName + `
+  struct:
+    fields:
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: ` + portName + `
+          elementRelationship: associative
+          keys:
+          - name
+          - protocol
+    - name: tags
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: command
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: env
+      type:
+        map:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: weights
+      type:
+        map:
+          elementType:
+            scalar: float
+          keyType: integer
+    - name: children
+      type:
+        list:
+          elementType:
+            namedType: ` + nodeName + `
+          elementRelationship: atomic
+    - name: parent
+      type:
+        namedType: ` + nodeName + `
+    - name: color
+      type:
+        struct:
+          fields:
+          - name: R
+            type:
+              scalar: integer
+          - name: G
+            type:
+              scalar: integer
+          - name: B
+            type:
+              scalar: integer
+          elementRelationship: atomic
+    - name: extra
+      type:
+        map:
+          elementType:
+            untyped: {}
+    - name: data
+      type:
+        scalar: string
+    - name: weight
+      type:
+        scalar: float
+    - name: enabled
+      type:
+        scalar: boolean
+- name: ` + portName + `
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: number
+      type:
+        scalar: integer
+    - name: protocol
+      type:
+        scalar: string
+`
+	var expect Schema
+	if err := yaml.Unmarshal([]byte(expectYAML), &expect); err != nil {
+		t.Fatalf("unable to unmarshal expected schema: %v", err)
+	}
+	if !reflect.DeepEqual(&expect, s) {
+		got, _ := yaml.Marshal(s)
+		t.Errorf("expected\n%s\ngot\n%s", expectYAML, got)
+	}
+}
+
+type testEmbeddedA struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Tagged string `json:"Tagged"`
+}
+
+type testEmbeddedB struct {
+	Value  string `json:"value"`
+	Tagged string
+}
+
+type testShadow struct {
+	testEmbeddedA
+	*testEmbeddedB
+	// Name shadows testEmbeddedA.Name; "value" is ambiguous, and
+	// "Tagged" goes to the tagged field.
+	Name string `json:"name"`
+}
+
+func TestFromGoTypesPromotedFields(t *testing.T) {
+	s, err := FromGoTypes(reflect.TypeOf(testShadow{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectYAML := `types:
+- name: ` + GoTypeName(reflect.TypeOf(testShadow{})) + `
+  struct:
+    fields:
+    - name: kind
+      type:
+        scalar: string
+    - name: Tagged
+      type:
+        scalar: string
+    - name: name
+      type:
+        scalar: string
+`
+	var expect Schema
+	if err := yaml.Unmarshal([]byte(expectYAML), &expect); err != nil {
+		t.Fatalf("unable to unmarshal expected schema: %v", err)
+	}
+	if !reflect.DeepEqual(&expect, s) {
+		got, _ := yaml.Marshal(s)
+		t.Errorf("expected\n%s\ngot\n%s", expectYAML, got)
+	}
+}
+
+type testText struct{}
+
+func (testText) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func TestFromGoTypesMarshalers(t *testing.T) {
+	type marshalers struct {
+		Time    time.Time       `json:"time"`
+		TimePtr *time.Time      `json:"timePtr"`
+		Text    testText        `json:"text"`
+		Raw     json.RawMessage `json:"raw"`
+		Bytes   [2]byte         `json:"bytes"`
+	}
+	s, err := FromGoTypes(reflect.TypeOf(marshalers{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectYAML := `types:
+- name: ` + GoTypeName(reflect.TypeOf(marshalers{})) + `
+  struct:
+    fields:
+    - name: time
+      type:
+        scalar: string
+    - name: timePtr
+      type:
+        scalar: string
+    - name: text
+      type:
+        scalar: string
+    - name: raw
+      type:
+        untyped: {}
+    - name: bytes
+      type:
+        list:
+          elementType:
+            scalar: integer
+          elementRelationship: atomic
+`
+	var expect Schema
+	if err := yaml.Unmarshal([]byte(expectYAML), &expect); err != nil {
+		t.Fatalf("unable to unmarshal expected schema: %v", err)
+	}
+	if !reflect.DeepEqual(&expect, s) {
+		got, _ := yaml.Marshal(s)
+		t.Errorf("expected\n%s\ngot\n%s", expectYAML, got)
+	}
+}
+
+func TestFromGoTypesErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		obj  interface{}
+	}{
+		{"listMap without key", struct {
+			L []testPort `json:"l" schema:"listType=map"`
+		}{}},
+		{"unknown listType", struct {
+			L []string `json:"l" schema:"listType=bag"`
+		}{}},
+		{"unknown marker", struct {
+			L []string `json:"l" schema:"ordered=true"`
+		}{}},
+		{"non-string map key", struct {
+			M map[float64]string `json:"m"`
+		}{}},
+		{"channel", struct {
+			C chan int `json:"c"`
+		}{}},
+		{"structType on named type", struct {
+			P testPort `json:"p" schema:"structType=atomic"`
+		}{}},
+	}
+	for _, tt := range cases {
+		if _, err := FromGoTypes(reflect.TypeOf(tt.obj)); err == nil {
+			t.Errorf("%v: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"errors"
+
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+// FromValues infers a schema from sample values, which are all assumed to be
+// of the same type. The schema has a single TypeDef, named typeName; nested
+// types are inlined. The rules are:
+//  * scalars get the kind observed; integers and floats together make a
+//    float, and anything else that disagrees makes atomic untyped data;
+//  * a map becomes a struct if its keys are stable: on average, each sample
+//    must have at least half of all the keys seen. Otherwise it becomes a
+//    map of the values seen under every key;
+//  * a list of maps becomes an associative list if every item of every
+//    sample is keyed by the same fields, as guessed with
+//    fieldpath.AssociativeListCandidateFieldNames, and the keys are unique
+//    within each sample. Other lists are atomic;
+//  * values which are only ever null become atomic untyped data.
+// The result is only a starting point, and should be reviewed by a human.
+func FromValues(typeName string, samples ...value.Value) (*Schema, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("at least one sample is required")
+	}
+	root := &shape{}
+	for _, v := range samples {
+		root.observe(v)
+	}
+	return &Schema{Types: []TypeDef{{
+		Name: typeName,
+		Atom: root.atom(),
+	}}}, nil
+}
+
+// shape accumulates the values observed at one spot of the samples.
+type shape struct {
+	ints, floats, strings, bools int
+
+	// maps counts the map values observed; fields holds the values of
+	// each key (in the order keys were first seen), and elements the
+	// values of all keys, in case the maps turn out not to be structs.
+	maps       int
+	fieldNames []string
+	fields     map[string]*shape
+	keyCount   int
+	elements   *shape
+
+	// lists holds the list values observed, for guessing keys; items the
+	// values of all of their items.
+	lists []*value.List
+	items *shape
+}
+
+func (s *shape) observe(v value.Value) {
+	switch {
+	case v.Int != nil:
+		s.ints++
+	case v.Float != nil:
+		s.floats++
+	case v.String != nil:
+		s.strings++
+	case v.Boolean != nil:
+		s.bools++
+	case v.Map != nil:
+		s.maps++
+		if s.fields == nil {
+			s.fields = map[string]*shape{}
+			s.elements = &shape{}
+		}
+		for _, f := range v.Map.Items {
+			fs, ok := s.fields[f.Name]
+			if !ok {
+				fs = &shape{}
+				s.fields[f.Name] = fs
+				s.fieldNames = append(s.fieldNames, f.Name)
+			}
+			fs.observe(f.Value)
+			s.elements.observe(f.Value)
+			s.keyCount++
+		}
+	case v.List != nil:
+		s.lists = append(s.lists, v.List)
+		if s.items == nil {
+			s.items = &shape{}
+		}
+		for _, item := range v.List.Items {
+			s.items.observe(item)
+		}
+	}
+}
+
+func (s *shape) atom() Atom {
+	kinds := 0
+	for _, n := range []int{s.ints + s.floats, s.strings, s.bools, s.maps, len(s.lists)} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		// Nothing but nulls, or samples which disagree.
+		return Atom{Untyped: &Untyped{}}
+	}
+
+	switch {
+	case s.floats > 0:
+		return scalarRef(Float).Inlined
+	case s.ints > 0:
+		return scalarRef(Integer).Inlined
+	case s.strings > 0:
+		return scalarRef(String).Inlined
+	case s.bools > 0:
+		return scalarRef(Boolean).Inlined
+	case s.maps > 0:
+		return s.mapOrStructAtom()
+	}
+	return s.listAtom()
+}
+
+func (s *shape) mapOrStructAtom() Atom {
+	// keyCount/maps is the average number of keys per sample.
+	if len(s.fieldNames) > 0 && 2*s.keyCount < s.maps*len(s.fieldNames) {
+		return Atom{Map: &Map{ElementType: TypeRef{Inlined: s.elements.atom()}}}
+	}
+	st := &Struct{}
+	for _, name := range s.fieldNames {
+		st.Fields = append(st.Fields, StructField{
+			Name: name,
+			Type: TypeRef{Inlined: s.fields[name].atom()},
+		})
+	}
+	return Atom{Struct: st}
+}
+
+func (s *shape) listAtom() Atom {
+	l := &List{ElementRelationship: Atomic}
+	if s.items == nil {
+		// Only empty lists were seen.
+		l.ElementType = TypeRef{Inlined: Atom{Untyped: &Untyped{}}}
+		return Atom{List: l}
+	}
+	l.ElementType = TypeRef{Inlined: s.items.atom()}
+	if l.ElementType.Inlined.Struct != nil {
+		if keys := fieldpath.GuessListKeys(s.lists...); len(keys) > 0 {
+			l.ElementRelationship = Associative
+			l.Keys = keys
+		}
+	}
+	return Atom{List: l}
+}
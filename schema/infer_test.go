@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/value"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestFromValues(t *testing.T) {
+	samples := []string{
+		`{"name":"a","replicas":1,"ratio":1,"labels":{"app":"a"},"ports":[{"name":"http","port":80}],"args":["-v"],"extra":1,"empty":[],"nothing":null}`,
+		`{"name":"b","replicas":2,"ratio":0.5,"labels":{"tier":"b"},"ports":[{"name":"http","port":80},{"name":"dns","port":53}],"args":["-v","-v"],"extra":"x"}`,
+		`{"name":"c","enabled":true,"labels":{"env":"c","owner":"d"},"ports":[{"port":1}],"empty":[]}`,
+	}
+	var values []value.Value
+	for _, s := range samples {
+		v, err := value.FromYAML([]byte(s))
+		if err != nil {
+			t.Fatalf("unable to interpret yaml: %v\n%v", err, s)
+		}
+		values = append(values, v)
+	}
+
+	s, err := FromValues("config", values...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectYAML := `types:
+- name: config
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: replicas
+      type:
+        scalar: integer
+    - name: ratio
+      type:
+        scalar: float
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: ports
+      type:
+        list:
+          elementType:
+            struct:
+              fields:
+              - name: name
+                type:
+                  scalar: string
+              - name: port
+                type:
+                  scalar: integer
+          elementRelationship: atomic
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: extra
+      type:
+        untyped: {}
+    - name: empty
+      type:
+        list:
+          elementType:
+            untyped: {}
+          elementRelationship: atomic
+    - name: nothing
+      type:
+        untyped: {}
+    - name: enabled
+      type:
+        scalar: boolean
+`
+	var expect Schema
+	if err := yaml.Unmarshal([]byte(expectYAML), &expect); err != nil {
+		t.Fatalf("unable to unmarshal expected schema: %v", err)
+	}
+	if !reflect.DeepEqual(&expect, s) {
+		got, _ := yaml.Marshal(s)
+		t.Errorf("expected\n%s\ngot\n%s", expectYAML, got)
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("inferred schema is invalid: %v", err)
+	}
+}
+
+func TestFromValuesAssociativeList(t *testing.T) {
+	v, err := value.FromYAML([]byte(`{"ports":[{"name":"http","port":80},{"name":"dns","port":53}]}`))
+	if err != nil {
+		t.Fatalf("unable to interpret yaml: %v", err)
+	}
+	s, err := FromValues("config", v)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l := s.Types[0].Struct.Fields[0].Type.Inlined.List
+	if l == nil || l.ElementRelationship != Associative || !reflect.DeepEqual(l.Keys, []string{"name"}) {
+		got, _ := yaml.Marshal(s)
+		t.Errorf("expected an associative list keyed by name, got\n%s", got)
+	}
+
+	if _, err := FromValues("config"); err == nil {
+		t.Errorf("expected an error without samples")
+	}
+}
@@ -0,0 +1,782 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+// The JSON Schema produced by ToJSONSchema and ToOpenAPI uses the Kubernetes
+// extensions to describe merge semantics where they exist, and extensions
+// prefixed with "x-smd-" for the rest, so that FromJSONSchema can restore
+// the original schema:
+//  * `x-kubernetes-list-type` is `atomic`, `set` (associative list without
+//    keys) or `map` (associative list with `x-kubernetes-list-map-keys`);
+//  * `x-kubernetes-map-type` is `atomic` for atomic maps and structs;
+//  * `x-kubernetes-preserve-unknown-fields` marks untyped data, and structs
+//    which preserve unknown fields;
+//  * `x-smd-scalar: numeric` tells numeric scalars from floats, which are
+//    both numbers in JSON Schema;
+//  * scalar unions are an `anyOf` of their kinds, and `integer|string` is
+//    also marked with `x-kubernetes-int-or-string`;
+//  * `x-smd-element-relationship` holds the guess and lookup relationships
+//    of untyped data;
+//  * `x-smd-key-type` holds the key type of maps with non-string keys;
+//  * `x-smd-element-default` holds the element default of lists and maps;
+//  * `x-smd-nullable: false` marks struct fields which may not be null;
+//  * `x-smd-former-names` holds the former names of struct fields;
+//  * `x-smd-immutable: true` marks immutable structs, lists and maps;
+//  * `x-smd-list-type: positional` marks positional lists, which are
+//    otherwise exported as atomic.
+// Immutable struct fields get the `self == oldSelf` validation rule of
+// `x-kubernetes-validations`, which Kubernetes enforces the same way.
+// Nullable struct fields are marked with `nullable: true`, as in OpenAPI.
+const (
+	jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+	openAPIVersion    = "3.0.3"
+	immutableRule     = "self == oldSelf"
+)
+
+// ToJSONSchema returns a JSON Schema (draft 2020-12) document describing the
+// type named rootType. Every type of s is included in `$defs`. References to
+// the types of other schemas of a Registry can't be exported.
+func ToJSONSchema(s *Schema, rootType string) ([]byte, error) {
+	e := jsonSchemaExporter{schema: s, refPrefix: "#/$defs/"}
+	if _, ok := s.FindNamedType(rootType); !ok {
+		return nil, fmt.Errorf("no type found matching: %v", rootType)
+	}
+	defs, err := e.defs()
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSONObject(jsonObject{
+		{"$schema", jsonSchemaDialect},
+		{"$ref", e.refPrefix + jsonPointerEscape(rootType)},
+		{"$defs", defs},
+	})
+}
+
+// ToOpenAPI returns an OpenAPI v3 document with a component schema for
+// every type of s.
+func ToOpenAPI(s *Schema) ([]byte, error) {
+	e := jsonSchemaExporter{schema: s, refPrefix: "#/components/schemas/", openAPI: true}
+	defs, err := e.defs()
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSONObject(jsonObject{
+		{"openapi", openAPIVersion},
+		{"info", jsonObject{{"title", "schema"}, {"version", "v1"}}},
+		{"paths", jsonObject{}},
+		{"components", jsonObject{{"schemas", defs}}},
+	})
+}
+
+// jsonObject is a JSON object which keeps the order of its fields, so that
+// the output is stable and follows the order of the schema.
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (o jsonObject) get(key string) (interface{}, bool) {
+	for _, f := range o {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", f.key, err)
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func marshalJSONObject(o jsonObject) ([]byte, error) {
+	return json.MarshalIndent(o, "", "  ")
+}
+
+type jsonSchemaExporter struct {
+	schema    *Schema
+	refPrefix string
+	// openAPI restricts the output to what OpenAPI v3.0 allows: for
+	// example, `$ref` can't have siblings.
+	openAPI bool
+}
+
+func (e *jsonSchemaExporter) defs() (jsonObject, error) {
+	defs := jsonObject{}
+	for _, t := range e.schema.Types {
+		def, err := e.atom(t.Atom)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", t.Name, err)
+		}
+		defs = append(defs, jsonField{t.Name, def})
+	}
+	return defs, nil
+}
+
+func (e *jsonSchemaExporter) typeRef(tr TypeRef) (jsonObject, error) {
+	if tr.NamedType == nil {
+		return e.atom(tr.Inlined)
+	}
+	name := *tr.NamedType
+	if _, ok := e.schema.FindNamedType(name); !ok {
+		if _, _, ok := e.schema.ResolveWithSchema(tr); ok {
+			// The document only has the types of e.schema.
+			return nil, fmt.Errorf("type %v is defined in another schema, which can't be referenced", name)
+		}
+		return nil, fmt.Errorf("no type found matching: %v", name)
+	}
+	return jsonObject{{"$ref", e.refPrefix + jsonPointerEscape(name)}}, nil
+}
+
+var (
+	jsonPointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// jsonPointerEscape escapes name to be used as a JSON pointer token (RFC
+// 6901), since type names may contain slashes.
+func jsonPointerEscape(name string) string {
+	return jsonPointerEscaper.Replace(name)
+}
+
+// withSiblings adds fields to o, which may be a reference.
+func (e *jsonSchemaExporter) withSiblings(o jsonObject, fields ...jsonField) jsonObject {
+	if len(fields) == 0 {
+		return o
+	}
+	if _, isRef := o.get("$ref"); isRef && e.openAPI {
+		o = jsonObject{{"allOf", []jsonObject{o}}}
+	}
+	return append(o, fields...)
+}
+
+// unstructured converts a default or enum value from the schema into a form
+// encoding/json accepts, keeping the order of map fields.
+func unstructured(v interface{}) (interface{}, error) {
+	val, err := value.FromUnstructured(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonValue(val), nil
+}
+
+func jsonValue(v value.Value) interface{} {
+	switch {
+	case v.Map != nil:
+		o := jsonObject{}
+		for _, f := range v.Map.Items {
+			o = append(o, jsonField{f.Name, jsonValue(f.Value)})
+		}
+		return o
+	case v.List != nil:
+		l := []interface{}{}
+		for _, item := range v.List.Items {
+			l = append(l, jsonValue(item))
+		}
+		return l
+	}
+	return v.ToUnstructured(false)
+}
+
+func (e *jsonSchemaExporter) atom(a Atom) (o jsonObject, err error) {
+	switch {
+	case a.Scalar != nil:
+		o = scalarJSONSchema(*a.Scalar)
+	case a.Struct != nil:
+		o, err = e.structJSONSchema(a.Struct)
+	case a.List != nil:
+		o, err = e.listJSONSchema(a.List)
+	case a.Map != nil:
+		o, err = e.mapJSONSchema(a.Map)
+	case a.Untyped != nil:
+		o = jsonObject{{"x-kubernetes-preserve-unknown-fields", true}}
+		switch a.Untyped.ElementRelationship {
+		case "", Atomic:
+		default:
+			o = append(o, jsonField{"x-smd-element-relationship", string(a.Untyped.ElementRelationship)})
+		}
+	default:
+		return nil, fmt.Errorf("invalid atom")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.Constraints != nil {
+		return constraintsJSONSchema(o, a.Constraints)
+	}
+	return o, nil
+}
+
+func scalarJSONSchema(s Scalar) jsonObject {
+	if kinds := s.Kinds(); len(kinds) > 1 {
+		var anyOf []interface{}
+		for _, k := range kinds {
+			anyOf = append(anyOf, scalarJSONSchema(k))
+		}
+		o := jsonObject{{"anyOf", anyOf}}
+		if len(kinds) == 2 && kinds[0] == Integer && kinds[1] == String {
+			o = append(o, jsonField{"x-kubernetes-int-or-string", true})
+		}
+		return o
+	}
+	switch s {
+	case Integer:
+		return jsonObject{{"type", "integer"}}
+	case Numeric:
+		return jsonObject{{"type", "number"}, {"x-smd-scalar", "numeric"}}
+	case Float:
+		return jsonObject{{"type", "number"}}
+	}
+	return jsonObject{{"type", string(s)}}
+}
+
+func (e *jsonSchemaExporter) structJSONSchema(st *Struct) (jsonObject, error) {
+	o := jsonObject{{"type", "object"}}
+	props := jsonObject{}
+	var required []string
+	for _, f := range st.Fields {
+		p, err := e.typeRef(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf(".%v: %v", f.Name, err)
+		}
+		var siblings []jsonField
+		if f.Default != nil {
+			d, err := unstructured(f.Default)
+			if err != nil {
+				return nil, fmt.Errorf(".%v: invalid default: %v", f.Name, err)
+			}
+			siblings = append(siblings, jsonField{"default", d})
+		}
+		if f.Nullable != nil {
+			if *f.Nullable {
+				siblings = append(siblings, jsonField{"nullable", true})
+			} else {
+				siblings = append(siblings, jsonField{"x-smd-nullable", false})
+			}
+		}
+		if len(f.FormerNames) > 0 {
+			siblings = append(siblings, jsonField{"x-smd-former-names", f.FormerNames})
+		}
+		if f.Immutable {
+			siblings = append(siblings, jsonField{"x-kubernetes-validations", []jsonObject{{
+				{"rule", immutableRule},
+				{"message", "field is immutable"},
+			}}})
+		}
+		props = append(props, jsonField{f.Name, e.withSiblings(p, siblings...)})
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	o = append(o, jsonField{"properties", props})
+	if len(required) > 0 {
+		o = append(o, jsonField{"required", required})
+	}
+	if st.PreserveUnknownFields {
+		o = append(o, jsonField{"x-kubernetes-preserve-unknown-fields", true})
+	} else {
+		o = append(o, jsonField{"additionalProperties", false})
+	}
+	if st.ElementRelationship == Atomic {
+		o = append(o, jsonField{"x-kubernetes-map-type", "atomic"})
+	}
+	if st.Immutable {
+		o = append(o, jsonField{"x-smd-immutable", true})
+	}
+	return o, nil
+}
+
+func (e *jsonSchemaExporter) listJSONSchema(l *List) (jsonObject, error) {
+	items, err := e.typeRef(l.ElementType)
+	if err != nil {
+		return nil, fmt.Errorf("[]: %v", err)
+	}
+	o := jsonObject{{"type", "array"}, {"items", items}}
+	switch {
+	case l.ElementRelationship == Associative && len(l.Keys) > 0:
+		o = append(o, jsonField{"x-kubernetes-list-type", "map"}, jsonField{"x-kubernetes-list-map-keys", l.Keys})
+	case l.ElementRelationship == Associative:
+		o = append(o, jsonField{"x-kubernetes-list-type", "set"}, jsonField{"uniqueItems", true})
+	case l.ElementRelationship == Positional:
+		// Kubernetes has no equivalent; atomic is the closest.
+		o = append(o, jsonField{"x-kubernetes-list-type", "atomic"}, jsonField{"x-smd-list-type", "positional"})
+	default:
+		o = append(o, jsonField{"x-kubernetes-list-type", "atomic"})
+	}
+	if l.ElementDefault != nil {
+		d, err := unstructured(l.ElementDefault)
+		if err != nil {
+			return nil, fmt.Errorf("invalid element default: %v", err)
+		}
+		o = append(o, jsonField{"x-smd-element-default", d})
+	}
+	if l.Immutable {
+		o = append(o, jsonField{"x-smd-immutable", true})
+	}
+	return o, nil
+}
+
+func (e *jsonSchemaExporter) mapJSONSchema(m *Map) (jsonObject, error) {
+	elem, err := e.typeRef(m.ElementType)
+	if err != nil {
+		return nil, fmt.Errorf("{}: %v", err)
+	}
+	o := jsonObject{{"type", "object"}, {"additionalProperties", elem}}
+	if m.KeyType != "" && m.KeyType != String {
+		o = append(o, jsonField{"x-smd-key-type", string(m.KeyType)})
+	}
+	if m.ElementRelationship == Atomic {
+		o = append(o, jsonField{"x-kubernetes-map-type", "atomic"})
+	}
+	if m.ElementDefault != nil {
+		d, err := unstructured(m.ElementDefault)
+		if err != nil {
+			return nil, fmt.Errorf("invalid element default: %v", err)
+		}
+		o = append(o, jsonField{"x-smd-element-default", d})
+	}
+	if m.Immutable {
+		o = append(o, jsonField{"x-smd-immutable", true})
+	}
+	return o, nil
+}
+
+func constraintsJSONSchema(o jsonObject, c *Constraints) (jsonObject, error) {
+	if len(c.Enum) > 0 {
+		var enum []interface{}
+		for _, v := range c.Enum {
+			u, err := unstructured(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid enum value: %v", err)
+			}
+			enum = append(enum, u)
+		}
+		o = append(o, jsonField{"enum", enum})
+	}
+	if c.Format != "" {
+		o = append(o, jsonField{"format", c.Format})
+	}
+	if c.Pattern != "" {
+		o = append(o, jsonField{"pattern", c.Pattern})
+	}
+	for _, f := range []struct {
+		key string
+		v   *int64
+	}{
+		{"minLength", c.MinLength},
+		{"maxLength", c.MaxLength},
+		{"minItems", c.MinItems},
+		{"maxItems", c.MaxItems},
+		{"maxProperties", c.MaxProperties},
+	} {
+		if f.v != nil {
+			o = append(o, jsonField{f.key, *f.v})
+		}
+	}
+	for _, f := range []struct {
+		key string
+		v   *float64
+	}{
+		{"minimum", c.Minimum},
+		{"maximum", c.Maximum},
+		{"multipleOf", c.MultipleOf},
+	} {
+		if f.v != nil {
+			o = append(o, jsonField{f.key, *f.v})
+		}
+	}
+	return o, nil
+}
+
+// FromJSONSchema reads a JSON Schema or OpenAPI v3 document (in JSON or YAML),
+// such as those written by ToJSONSchema and ToOpenAPI, and returns a schema
+// with a type for each of its definitions (`$defs`, `definitions` or
+// `components.schemas`), in order. References must point to definitions of the
+// same document. Keywords which don't affect the schema (e.g. `description`)
+// are ignored, and so are the ones this package can't represent (e.g.
+// `oneOf`).
+func FromJSONSchema(data []byte) (*Schema, error) {
+	doc, err := value.FromYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Map == nil {
+		return nil, fmt.Errorf("expected an object, got %v", doc.HumanReadable())
+	}
+	var defs *value.Map
+	switch {
+	case getMap(doc.Map, "$defs") != nil:
+		defs = getMap(doc.Map, "$defs")
+	case getMap(doc.Map, "definitions") != nil:
+		defs = getMap(doc.Map, "definitions")
+	case getMap(doc.Map, "components") != nil:
+		defs = getMap(getMap(doc.Map, "components"), "schemas")
+	}
+	if defs == nil {
+		return nil, fmt.Errorf("no definitions found")
+	}
+
+	s := &Schema{}
+	for _, def := range defs.Items {
+		if def.Value.Map == nil {
+			return nil, fmt.Errorf("%v: expected an object", def.Name)
+		}
+		a, err := atomFromJSONSchema(def.Value.Map)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", def.Name, err)
+		}
+		s.Types = append(s.Types, TypeDef{Name: def.Name, Atom: a})
+	}
+	return s, nil
+}
+
+func getMap(m *value.Map, key string) *value.Map {
+	if m == nil {
+		return nil
+	}
+	if f, ok := m.Get(key); ok {
+		return f.Value.Map
+	}
+	return nil
+}
+
+func getString(m *value.Map, key string) string {
+	if f, ok := m.Get(key); ok && f.Value.String != nil {
+		return string(*f.Value.String)
+	}
+	return ""
+}
+
+func getBool(m *value.Map, key string) (bool, bool) {
+	if f, ok := m.Get(key); ok && f.Value.Boolean != nil {
+		return bool(*f.Value.Boolean), true
+	}
+	return false, false
+}
+
+// getStrings returns the strings of the list under key, if any.
+func getStrings(m *value.Map, key string) []string {
+	var out []string
+	if f, ok := m.Get(key); ok && f.Value.List != nil {
+		for _, item := range f.Value.List.Items {
+			if item.String != nil {
+				out = append(out, string(*item.String))
+			}
+		}
+	}
+	return out
+}
+
+func getInt(m *value.Map, key string) *int64 {
+	if f, ok := m.Get(key); ok && f.Value.Int != nil {
+		i := int64(*f.Value.Int)
+		return &i
+	}
+	return nil
+}
+
+func getFloat(m *value.Map, key string) *float64 {
+	f, ok := m.Get(key)
+	if !ok {
+		return nil
+	}
+	var out float64
+	switch {
+	case f.Value.Int != nil:
+		out = float64(*f.Value.Int)
+	case f.Value.Float != nil:
+		out = float64(*f.Value.Float)
+	default:
+		return nil
+	}
+	return &out
+}
+
+// unwrapRef returns the wrapped schema of an `allOf` with a single member,
+// which OpenAPI v3.0 uses to give siblings to `$ref`.
+func unwrapRef(m *value.Map) *value.Map {
+	if f, ok := m.Get("allOf"); ok && f.Value.List != nil && len(f.Value.List.Items) == 1 {
+		return f.Value.List.Items[0].Map
+	}
+	return m
+}
+
+func typeRefFromJSONSchema(v value.Value) (TypeRef, error) {
+	if v.Map == nil {
+		return TypeRef{}, fmt.Errorf("expected an object, got %v", v.HumanReadable())
+	}
+	m := unwrapRef(v.Map)
+	if ref := getString(m, "$ref"); ref != "" {
+		name, err := refName(ref)
+		if err != nil {
+			return TypeRef{}, err
+		}
+		return TypeRef{NamedType: &name}, nil
+	}
+	a, err := atomFromJSONSchema(m)
+	if err != nil {
+		return TypeRef{}, err
+	}
+	return TypeRef{Inlined: a}, nil
+}
+
+// jsonDefsPrefixes are the JSON pointers to the definitions of a document.
+var jsonDefsPrefixes = []string{"#/$defs/", "#/definitions/", "#/components/schemas/"}
+
+// refName returns the name of the definition ref points to.
+func refName(ref string) (string, error) {
+	for _, prefix := range jsonDefsPrefixes {
+		if !strings.HasPrefix(ref, prefix) {
+			continue
+		}
+		token := ref[len(prefix):]
+		if token == "" || strings.Contains(token, "/") {
+			break
+		}
+		return jsonPointerUnescaper.Replace(token), nil
+	}
+	return "", fmt.Errorf("unsupported reference %q", ref)
+}
+
+func atomFromJSONSchema(m *value.Map) (a Atom, err error) {
+	typ := getString(m, "type")
+	if f, ok := m.Get("type"); ok && f.Value.List != nil {
+		// e.g. ["string", "null"]; the first non-null type wins.
+		for _, t := range f.Value.List.Items {
+			if t.String != nil && *t.String != "null" {
+				typ = string(*t.String)
+				break
+			}
+		}
+	}
+	preserve, _ := getBool(m, "x-kubernetes-preserve-unknown-fields")
+	_, hasProperties := m.Get("properties")
+	additional, hasAdditional := m.Get("additionalProperties")
+
+	switch {
+	case typ == "":
+		if union := scalarUnionFromJSONSchema(m); union != "" {
+			a.Scalar = scalarPtr(union)
+		} else {
+			a.Untyped = &Untyped{ElementRelationship: ElementRelationship(getString(m, "x-smd-element-relationship"))}
+		}
+	case typ == "integer":
+		a.Scalar = scalarPtr(Integer)
+	case typ == "number" && getString(m, "x-smd-scalar") == "numeric":
+		a.Scalar = scalarPtr(Numeric)
+	case typ == "number":
+		a.Scalar = scalarPtr(Float)
+	case typ == "string":
+		a.Scalar = scalarPtr(String)
+	case typ == "boolean":
+		a.Scalar = scalarPtr(Boolean)
+	case typ == "array":
+		a.List, err = listFromJSONSchema(m)
+	case typ == "object" && hasAdditional && additional.Value.Map != nil:
+		a.Map, err = mapFromJSONSchema(m, additional.Value)
+	case typ == "object" && (hasProperties || !preserve):
+		a.Struct, err = structFromJSONSchema(m, preserve)
+	case typ == "object":
+		a.Untyped = &Untyped{ElementRelationship: ElementRelationship(getString(m, "x-smd-element-relationship"))}
+	default:
+		return Atom{}, fmt.Errorf("unsupported type %q", typ)
+	}
+	if err != nil {
+		return Atom{}, err
+	}
+	a.Constraints, err = constraintsFromJSONSchema(m)
+	return a, err
+}
+
+func scalarPtr(s Scalar) *Scalar { return &s }
+
+// scalarUnionFromJSONSchema returns the scalar union described by an `anyOf`
+// of scalar types, or by `x-kubernetes-int-or-string`; or "" if there is
+// none.
+func scalarUnionFromJSONSchema(m *value.Map) Scalar {
+	f, ok := m.Get("anyOf")
+	if !ok || f.Value.List == nil || len(f.Value.List.Items) == 0 {
+		if intOrString, _ := getBool(m, "x-kubernetes-int-or-string"); intOrString {
+			return Scalar(Integer + "|" + String)
+		}
+		return ""
+	}
+	var kinds []string
+	for _, item := range f.Value.List.Items {
+		if item.Map == nil {
+			return ""
+		}
+		a, err := atomFromJSONSchema(item.Map)
+		if err != nil || a.Scalar == nil {
+			return ""
+		}
+		kinds = append(kinds, string(*a.Scalar))
+	}
+	return Scalar(strings.Join(kinds, "|"))
+}
+
+func structFromJSONSchema(m *value.Map, preserve bool) (*Struct, error) {
+	st := &Struct{PreserveUnknownFields: preserve}
+	if getString(m, "x-kubernetes-map-type") == "atomic" {
+		st.ElementRelationship = Atomic
+	}
+	st.Immutable, _ = getBool(m, "x-smd-immutable")
+	required := map[string]bool{}
+	for _, r := range getStrings(m, "required") {
+		required[r] = true
+	}
+	if props := getMap(m, "properties"); props != nil {
+		for _, p := range props.Items {
+			tr, err := typeRefFromJSONSchema(p.Value)
+			if err != nil {
+				return nil, fmt.Errorf(".%v: %v", p.Name, err)
+			}
+			f := StructField{Name: p.Name, Type: tr, Required: required[p.Name]}
+			pm := p.Value.Map
+			if d, ok := pm.Get("default"); ok {
+				f.Default = d.Value.ToUnstructured(true)
+			}
+			if n, ok := getBool(pm, "nullable"); ok && n {
+				f.Nullable = &n
+			} else if n, ok := getBool(pm, "x-smd-nullable"); ok {
+				f.Nullable = &n
+			}
+			f.FormerNames = getStrings(pm, "x-smd-former-names")
+			f.Immutable = hasImmutableRule(pm)
+			st.Fields = append(st.Fields, f)
+		}
+	}
+	return st, nil
+}
+
+func listFromJSONSchema(m *value.Map) (*List, error) {
+	l := &List{ElementRelationship: Atomic}
+	items, ok := m.Get("items")
+	if !ok {
+		l.ElementType = TypeRef{Inlined: Atom{Untyped: &Untyped{}}}
+	} else {
+		tr, err := typeRefFromJSONSchema(items.Value)
+		if err != nil {
+			return nil, fmt.Errorf("[]: %v", err)
+		}
+		l.ElementType = tr
+	}
+	switch getString(m, "x-kubernetes-list-type") {
+	case "set":
+		l.ElementRelationship = Associative
+	case "map":
+		l.ElementRelationship = Associative
+		l.Keys = getStrings(m, "x-kubernetes-list-map-keys")
+	}
+	if getString(m, "x-smd-list-type") == "positional" {
+		l.ElementRelationship = Positional
+	}
+	if d, ok := m.Get("x-smd-element-default"); ok {
+		l.ElementDefault = d.Value.ToUnstructured(true)
+	}
+	l.Immutable, _ = getBool(m, "x-smd-immutable")
+	return l, nil
+}
+
+// hasImmutableRule returns true if m has the `self == oldSelf` validation
+// rule. Other rules are ignored.
+func hasImmutableRule(m *value.Map) bool {
+	f, ok := m.Get("x-kubernetes-validations")
+	if !ok || f.Value.List == nil {
+		return false
+	}
+	for _, r := range f.Value.List.Items {
+		if r.Map != nil && getString(r.Map, "rule") == immutableRule {
+			return true
+		}
+	}
+	return false
+}
+
+func mapFromJSONSchema(m *value.Map, additional value.Value) (*Map, error) {
+	tr, err := typeRefFromJSONSchema(additional)
+	if err != nil {
+		return nil, fmt.Errorf("{}: %v", err)
+	}
+	mt := &Map{ElementType: tr, KeyType: Scalar(getString(m, "x-smd-key-type"))}
+	if getString(m, "x-kubernetes-map-type") == "atomic" {
+		mt.ElementRelationship = Atomic
+	}
+	if d, ok := m.Get("x-smd-element-default"); ok {
+		mt.ElementDefault = d.Value.ToUnstructured(true)
+	}
+	mt.Immutable, _ = getBool(m, "x-smd-immutable")
+	return mt, nil
+}
+
+func constraintsFromJSONSchema(m *value.Map) (*Constraints, error) {
+	c := &Constraints{
+		Format:        getString(m, "format"),
+		Pattern:       getString(m, "pattern"),
+		MinLength:     getInt(m, "minLength"),
+		MaxLength:     getInt(m, "maxLength"),
+		MinItems:      getInt(m, "minItems"),
+		MaxItems:      getInt(m, "maxItems"),
+		MaxProperties: getInt(m, "maxProperties"),
+		Minimum:       getFloat(m, "minimum"),
+		Maximum:       getFloat(m, "maximum"),
+		MultipleOf:    getFloat(m, "multipleOf"),
+	}
+	if f, ok := m.Get("enum"); ok {
+		if f.Value.List == nil {
+			return nil, fmt.Errorf("enum must be a list")
+		}
+		for _, v := range f.Value.List.Items {
+			c.Enum = append(c.Enum, v.ToUnstructured(true))
+		}
+	}
+	if reflect.DeepEqual(c, &Constraints{}) {
+		return nil, nil
+	}
+	return c, nil
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var jsonSchemaRoundTripSchema = `types:
+- name: deployment
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+        constraints:
+          pattern: ^[a-z]+$
+          maxLength: 63
+      required: true
+      immutable: true
+    - name: strategy
+      type:
+        scalar: string
+        constraints:
+          enum:
+          - Recreate
+          - RollingUpdate
+      default: RollingUpdate
+    - name: replicas
+      type:
+        scalar: integer
+        constraints:
+          minimum: 0
+    - name: ratio
+      type:
+        scalar: numeric
+      nullable: true
+    - name: weight
+      type:
+        scalar: float
+    - name: cpu
+      type:
+        scalar: string
+        constraints:
+          format: quantity
+    - name: port
+      type:
+        scalar: integer|string
+    - name: limit
+      type:
+        scalar: numeric|string
+    - name: paused
+      type:
+        scalar: boolean
+      nullable: false
+    - name: containers
+      type:
+        list:
+          elementType:
+            namedType: container
+          elementRelationship: associative
+          keys:
+          - name
+        constraints:
+          maxItems: 10
+    - name: finalizers
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+          elementDefault: ""
+          immutable: true
+    - name: command
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: ports
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: integer
+          elementRelationship: atomic
+    - name: selector
+      type:
+        namedType: selector
+      default:
+        app: web
+      nullable: false
+    - name: color
+      type:
+        struct:
+          fields:
+          - name: r
+            type:
+              scalar: integer
+          elementRelationship: atomic
+    - name: config
+      type:
+        untyped: {}
+    - name: plugin
+      type:
+        untyped:
+          elementRelationship: lookup
+    - name: extra
+      type:
+        struct:
+          fields:
+          - name: known
+            type:
+              scalar: string
+          preserveUnknownFields: true
+      formerNames:
+      - additional
+      - more
+- name: container
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+- name: selector
+  map:
+    elementType:
+      scalar: string
+`
+
+func TestJSONSchemaRoundTrip(t *testing.T) {
+	s := mustParseSchema(t, jsonSchemaRoundTripSchema)
+	for _, tt := range []struct {
+		name   string
+		export func(*Schema) ([]byte, error)
+	}{
+		{"jsonschema", func(s *Schema) ([]byte, error) { return ToJSONSchema(s, "deployment") }},
+		{"openapi", ToOpenAPI},
+	} {
+		data, err := tt.export(s)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.name, err)
+		}
+		got, err := FromJSONSchema(data)
+		if err != nil {
+			t.Fatalf("%v: unexpected error importing\n%s\n%v", tt.name, data, err)
+		}
+		// Defaults come back as ordered, JSON typed values, so compare
+		// the exports rather than the schemas themselves.
+		data2, err := tt.export(got)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.name, err)
+		}
+		if string(data) != string(data2) {
+			t.Errorf("%v: round trip changed the schema from\n%s\nto\n%s", tt.name, data, data2)
+		}
+		for i, f := range got.Types[0].Struct.Fields {
+			if f.Name == "selector" {
+				got.Types[0].Struct.Fields[i].Default = map[interface{}]interface{}{"app": "web"}
+			}
+		}
+		if !reflect.DeepEqual(s, got) {
+			y, _ := yaml.Marshal(got)
+			t.Errorf("%v: expected\n%s\ngot\n%s", tt.name, jsonSchemaRoundTripSchema, y)
+		}
+	}
+}
+
+type testPortList struct {
+	Ports []testPort `json:"ports" schema:"listType=map,listMapKey=name"`
+}
+
+func TestJSONSchemaRoundTripGoTypes(t *testing.T) {
+	// Go type names have dots and slashes.
+	s, err := FromGoTypes(reflect.TypeOf(testPortList{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := GoTypeName(reflect.TypeOf(testPortList{}))
+	s.Types = append(s.Types, TypeDef{Name: "a~b/c", Atom: Atom{Scalar: scalarPtr(String)}})
+	for _, tt := range []struct {
+		name   string
+		export func(*Schema) ([]byte, error)
+	}{
+		{"jsonschema", func(s *Schema) ([]byte, error) { return ToJSONSchema(s, root) }},
+		{"openapi", ToOpenAPI},
+	} {
+		data, err := tt.export(s)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.name, err)
+		}
+		got, err := FromJSONSchema(data)
+		if err != nil {
+			t.Fatalf("%v: unexpected error importing\n%s\n%v", tt.name, data, err)
+		}
+		if !reflect.DeepEqual(s, got) {
+			y, _ := yaml.Marshal(got)
+			t.Errorf("%v: round trip changed the schema to\n%s", tt.name, y)
+		}
+	}
+}
+
+func TestToJSONSchemaCrossSchemaReference(t *testing.T) {
+	meta := mustParseSchema(t, `package: meta
+types:
+- name: ObjectMeta
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+`)
+	apps := mustParseSchema(t, `package: apps
+types:
+- name: deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: meta.ObjectMeta
+`)
+	if _, err := NewRegistry(meta, apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ToJSONSchema(apps, "deployment"); err == nil {
+		t.Errorf("expected an error for a reference to another schema")
+	}
+	if _, err := ToOpenAPI(apps); err == nil {
+		t.Errorf("expected an error for a reference to another schema")
+	}
+}
+
+func TestToJSONSchema(t *testing.T) {
+	s := mustParseSchema(t, `types:
+- name: service
+  struct:
+    fields:
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+      nullable: true
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      required: true
+`)
+	expect := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$ref": "#/$defs/service",
+  "$defs": {
+    "service": {
+      "type": "object",
+      "properties": {
+        "ports": {
+          "type": "array",
+          "items": {
+            "$ref": "#/$defs/port"
+          },
+          "x-kubernetes-list-type": "map",
+          "x-kubernetes-list-map-keys": [
+            "port"
+          ],
+          "nullable": true
+        }
+      },
+      "additionalProperties": false
+    },
+    "port": {
+      "type": "object",
+      "properties": {
+        "port": {
+          "type": "integer"
+        }
+      },
+      "required": [
+        "port"
+      ],
+      "additionalProperties": false
+    }
+  }
+}`
+	got, err := ToJSONSchema(s, "service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != expect {
+		t.Errorf("expected\n%s\ngot\n%s", expect, got)
+	}
+
+	if _, err := ToJSONSchema(s, "missing"); err == nil {
+		t.Errorf("expected an error for a missing root type")
+	}
+}
+
+func TestFromOpenAPI(t *testing.T) {
+	// The schema of a CustomResourceDefinition, as found in the wild.
+	got, err := FromJSONSchema([]byte(`components:
+  schemas:
+    widget:
+      type: object
+      description: A widget.
+      properties:
+        spec:
+          type: object
+          properties:
+            size:
+              type: integer
+              format: int32
+              minimum: 1
+            tags:
+              type: array
+              items:
+                type: string
+              x-kubernetes-list-type: set
+            owner:
+              allOf:
+              - $ref: '#/components/schemas/owner'
+              nullable: true
+            template:
+              type: object
+              x-kubernetes-preserve-unknown-fields: true
+            maxSurge:
+              anyOf:
+              - type: integer
+              - type: string
+              x-kubernetes-int-or-string: true
+            targetPort:
+              x-kubernetes-int-or-string: true
+    owner:
+      type: object
+      additionalProperties:
+        type: string
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := mustParseSchema(t, `types:
+- name: widget
+  struct:
+    fields:
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: size
+            type:
+              scalar: integer
+              constraints:
+                format: int32
+                minimum: 1
+          - name: tags
+            type:
+              list:
+                elementType:
+                  scalar: string
+                elementRelationship: associative
+          - name: owner
+            type:
+              namedType: owner
+            nullable: true
+          - name: template
+            type:
+              untyped: {}
+          - name: maxSurge
+            type:
+              scalar: integer|string
+          - name: targetPort
+            type:
+              scalar: integer|string
+- name: owner
+  map:
+    elementType:
+      scalar: string
+`)
+	if !reflect.DeepEqual(expect, got) {
+		y, _ := yaml.Marshal(got)
+		t.Errorf("unexpected schema\n%s", y)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("imported schema is invalid: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+)
+
+// Registry is a collection of schemas which can reference each other's named
+// types, so that shared types (e.g. ObjectMeta) can be published once and
+// reused by many schemas.
+//
+// A type from another schema is referenced by its package-qualified name: the
+// Package of the schema defining it, a dot, and the name of the type, e.g.
+// "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta". Package and type names
+// may both contain dots (FromGoTypes names types like
+// "k8s.io/api/core/v1.PodSpec"); the name is matched against the registered
+// packages, preferring the longest. Unqualified names always refer to the
+// schema containing the reference, and are looked up first.
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+// NewRegistry returns a registry containing the given schemas. See Add.
+func NewRegistry(schemas ...*Schema) (*Registry, error) {
+	r := &Registry{schemas: map[string]*Schema{}}
+	for _, s := range schemas {
+		if err := r.Add(s); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds s to the registry under s.Package, which must be set and unique
+// within the registry. A schema can only be a member of a single registry.
+func (r *Registry) Add(s *Schema) error {
+	if s.Package == "" {
+		return fmt.Errorf("schemas added to a registry must have a package")
+	}
+	if _, ok := r.schemas[s.Package]; ok {
+		return fmt.Errorf("registry already has a schema for package %q", s.Package)
+	}
+	if s.registry != nil && s.registry != r {
+		return fmt.Errorf("schema for package %q is already in another registry", s.Package)
+	}
+	if r.schemas == nil {
+		r.schemas = map[string]*Schema{}
+	}
+	r.schemas[s.Package] = s
+	s.registry = r
+	return nil
+}
+
+// Get returns the schema for the given package, if there is one.
+func (r *Registry) Get(pkg string) (*Schema, bool) {
+	s, ok := r.schemas[pkg]
+	return s, ok
+}
+
+// findQualifiedType looks up a package-qualified type name. Both package and
+// type names may contain dots, so every registered package which prefixes the
+// name is tried, longest first.
+func (r *Registry) findQualifiedType(name string) (*Schema, TypeDef, bool) {
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '.' {
+			continue
+		}
+		s, ok := r.schemas[name[:i]]
+		if !ok {
+			continue
+		}
+		if t, ok := s.FindNamedType(name[i+1:]); ok {
+			return s, t, true
+		}
+	}
+	return nil, TypeDef{}, false
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func mustParseSchema(t *testing.T, y string) *Schema {
+	var s Schema
+	if err := yaml.Unmarshal([]byte(y), &s); err != nil {
+		t.Fatalf("unable to unmarshal schema: %v", err)
+	}
+	return &s
+}
+
+func TestRegistryResolve(t *testing.T) {
+	meta := mustParseSchema(t, `package: io.k8s.meta.v1
+types:
+- name: ObjectMeta
+  struct:
+    fields:
+    - name: labels
+      type:
+        namedType: Labels
+- name: Labels
+  map:
+    elementType:
+      scalar: string
+`)
+	apps := mustParseSchema(t, `package: io.k8s.apps.v1
+types:
+- name: Deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: io.k8s.meta.v1.ObjectMeta
+- name: Labels
+  scalar: string
+`)
+
+	str := func(s string) *string { return &s }
+
+	// Without a registry, qualified names don't resolve.
+	if _, _, ok := apps.ResolveWithSchema(TypeRef{NamedType: str("io.k8s.meta.v1.ObjectMeta")}); ok {
+		t.Errorf("qualified name resolved without a registry")
+	}
+
+	if _, err := NewRegistry(meta, apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, a, ok := apps.ResolveWithSchema(TypeRef{NamedType: str("io.k8s.meta.v1.ObjectMeta")})
+	if !ok || s != meta || a.Struct == nil {
+		t.Fatalf("expected to find ObjectMeta in the meta schema, got %v %v %v", s, a, ok)
+	}
+	// References nested in ObjectMeta are relative to its own schema.
+	s, a, ok = s.ResolveWithSchema(a.Struct.Fields[0].Type)
+	if !ok || s != meta || a.Map == nil {
+		t.Errorf("expected to find Labels map in the meta schema, got %v %v %v", s, a, ok)
+	}
+	// Local names win.
+	s, a, ok = apps.ResolveWithSchema(TypeRef{NamedType: str("Labels")})
+	if !ok || s != apps || a.Scalar == nil {
+		t.Errorf("expected to find Labels scalar in the apps schema, got %v %v %v", s, a, ok)
+	}
+	// Unknown packages and types.
+	for _, name := range []string{"io.k8s.core.v1.Pod", "io.k8s.meta.v1.Pod", "Pod"} {
+		if _, _, ok := apps.ResolveWithSchema(TypeRef{NamedType: str(name)}); ok {
+			t.Errorf("%v: unexpectedly resolved", name)
+		}
+	}
+}
+
+func TestRegistryResolveDottedNames(t *testing.T) {
+	// Type names as FromGoTypes makes them.
+	const metaYAML = `package: meta
+types:
+- name: k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+`
+	const appsYAML = `package: k8s.io/api/apps/v1
+types:
+- name: k8s.io/api/apps/v1.Deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: meta.k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta
+`
+	str := func(s string) *string { return &s }
+
+	meta := mustParseSchema(t, metaYAML)
+	apps := mustParseSchema(t, appsYAML)
+	if _, err := NewRegistry(meta, apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, a, ok := apps.ResolveWithSchema(TypeRef{NamedType: str("meta.k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta")})
+	if !ok || s != meta || a.Struct == nil {
+		t.Errorf("expected to find ObjectMeta in the meta schema, got %v %v %v", s, a, ok)
+	}
+	s, a, ok = meta.ResolveWithSchema(TypeRef{NamedType: str("k8s.io/api/apps/v1.k8s.io/api/apps/v1.Deployment")})
+	if !ok || s != apps || a.Struct == nil {
+		t.Errorf("expected to find Deployment in the apps schema, got %v %v %v", s, a, ok)
+	}
+
+	// When several packages prefix the name, the longest one wins.
+	meta = mustParseSchema(t, metaYAML)
+	apps = mustParseSchema(t, appsYAML)
+	metaK8s := mustParseSchema(t, `package: meta.k8s
+types:
+- name: io/apimachinery/pkg/apis/meta/v1.ObjectMeta
+  scalar: string
+`)
+	if _, err := NewRegistry(meta, metaK8s, apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, td, ok := apps.FindNamedTypeWithSchema("meta.k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta")
+	if !ok || s != metaK8s || td.Name != "io/apimachinery/pkg/apis/meta/v1.ObjectMeta" {
+		t.Errorf("expected to find the type in the meta.k8s schema, got %v %v %v", s, td, ok)
+	}
+}
+
+func TestRegistryAdd(t *testing.T) {
+	r, _ := NewRegistry()
+	if err := r.Add(&Schema{}); err == nil {
+		t.Errorf("expected an error for a schema without a package")
+	}
+	s := &Schema{Package: "a"}
+	if err := r.Add(s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Add(&Schema{Package: "a"}); err == nil {
+		t.Errorf("expected an error for a duplicate package")
+	}
+	r2, _ := NewRegistry()
+	if err := r2.Add(s); err == nil {
+		t.Errorf("expected an error for a schema in two registries")
+	}
+	if got, ok := r.Get("a"); !ok || got != s {
+		t.Errorf("expected to get the schema back")
+	}
+}
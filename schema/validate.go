@@ -0,0 +1,291 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks that the schema is well formed:
+//  * types have unique, non-empty names;
+//  * every atom has exactly one member set, with a valid element
+//    relationship;
+//  * named references can be resolved (through the Registry, if any);
+//  * the keys of associative lists refer to fields of their element struct;
+//  * no struct requires, through required fields which can't be null, a value
+//    of its own type, since such a struct could never be finite.
+// Recursive types are otherwise fine. Validate returns an error listing every
+// problem found, or nil.
+func (s *Schema) Validate() error {
+	v := schemaValidator{schema: s}
+	names := map[string]bool{}
+	for _, t := range s.Types {
+		v.typeName = t.Name
+		if t.Name == "" {
+			v.errorf("", "type has no name")
+		} else if names[t.Name] {
+			v.errorf("", "duplicate type name")
+		}
+		names[t.Name] = true
+		v.validateAtom("", t.Atom)
+	}
+	for _, t := range s.Types {
+		if t.Struct != nil {
+			v.typeName = t.Name
+			v.checkRequiredCycle(s, t.Name, nil, map[string]bool{})
+		}
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	if len(v.errs) == 1 {
+		return errors.New(v.errs[0])
+	}
+	messages := append([]string{"errors:"}, v.errs...)
+	return errors.New(strings.Join(messages, "\n  "))
+}
+
+type schemaValidator struct {
+	schema   *Schema
+	typeName string
+	errs     []string
+}
+
+// errorf records an error. Paths follow the conventions of SchemaChange.
+func (v *schemaValidator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Sprintf("%v%v: %v", v.typeName, path, fmt.Sprintf(format, args...)))
+}
+
+func (v *schemaValidator) validateTypeRef(path string, tr TypeRef) {
+	if tr.NamedType == nil {
+		v.validateAtom(path, tr.Inlined)
+		return
+	}
+	if atomMembers(tr.Inlined) != 0 {
+		v.errorf(path, "type reference has both a name and an inlined type")
+	}
+	if _, _, ok := v.schema.ResolveWithSchema(tr); !ok {
+		v.errorf(path, "no type found matching %v", *tr.NamedType)
+	}
+}
+
+func atomMembers(a Atom) int {
+	n := 0
+	if a.Scalar != nil {
+		n++
+	}
+	if a.Struct != nil {
+		n++
+	}
+	if a.List != nil {
+		n++
+	}
+	if a.Map != nil {
+		n++
+	}
+	if a.Untyped != nil {
+		n++
+	}
+	return n
+}
+
+func validScalar(s Scalar) bool {
+	seen := map[Scalar]bool{}
+	for _, k := range s.Kinds() {
+		switch k {
+		case Numeric, Integer, Float, String, Boolean:
+		default:
+			return false
+		}
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+	}
+	return true
+}
+
+func (v *schemaValidator) validateAtom(path string, a Atom) {
+	if n := atomMembers(a); n != 1 {
+		v.errorf(path, "expected exactly one of scalar, struct, list, map or untyped, got %v", n)
+		return
+	}
+	switch {
+	case a.Scalar != nil:
+		if !validScalar(*a.Scalar) {
+			v.errorf(path, "invalid scalar type %q", *a.Scalar)
+		}
+	case a.Struct != nil:
+		v.validateStruct(path, a.Struct)
+	case a.List != nil:
+		v.validateList(path, a.List)
+	case a.Map != nil:
+		switch a.Map.ElementRelationship {
+		case "", Separable, Atomic:
+		default:
+			v.errorf(path, "invalid element relationship %q for a map", a.Map.ElementRelationship)
+		}
+		if a.Map.KeyType != "" && (!validScalar(a.Map.KeyType) || len(a.Map.KeyType.Kinds()) > 1) {
+			v.errorf(path, "invalid map key type %q", a.Map.KeyType)
+		}
+		if a.Map.Immutable && a.Map.ElementRelationship != Atomic {
+			v.errorf(path, "only atomic maps may be immutable")
+		}
+		v.validateTypeRef(path+"{}", a.Map.ElementType)
+	case a.Untyped != nil:
+		switch a.Untyped.ElementRelationship {
+		case "", Atomic, Guess, Lookup:
+		default:
+			v.errorf(path, "invalid element relationship %q for untyped data", a.Untyped.ElementRelationship)
+		}
+	}
+}
+
+func (v *schemaValidator) validateStruct(path string, st *Struct) {
+	switch st.ElementRelationship {
+	case "", Separable, Atomic:
+	default:
+		v.errorf(path, "invalid element relationship %q for a struct", st.ElementRelationship)
+	}
+	if st.Immutable && st.ElementRelationship != Atomic {
+		v.errorf(path, "only atomic structs may be immutable")
+	}
+	names := map[string]bool{}
+	for _, f := range st.Fields {
+		if names[f.Name] {
+			v.errorf(path+"."+f.Name, "duplicate field name")
+		}
+		names[f.Name] = true
+	}
+	// Former names may not be shared with any other name of the struct.
+	for _, f := range st.Fields {
+		for _, name := range f.FormerNames {
+			if names[name] {
+				v.errorf(path+"."+f.Name, "duplicate field name %q", name)
+			}
+			names[name] = true
+		}
+		v.validateTypeRef(path+"."+f.Name, f.Type)
+	}
+}
+
+func (v *schemaValidator) validateList(path string, l *List) {
+	v.validateTypeRef(path+"[]", l.ElementType)
+	if l.Immutable && l.ElementRelationship != Atomic {
+		v.errorf(path, "only atomic lists may be immutable")
+	}
+	switch l.ElementRelationship {
+	case Atomic, Positional:
+		if len(l.Keys) > 0 {
+			v.errorf(path, "%v lists can't have keys", l.ElementRelationship)
+		}
+		return
+	case Associative:
+	default:
+		v.errorf(path, "invalid element relationship %q for a list", l.ElementRelationship)
+		return
+	}
+
+	s, elem, ok := v.schema.ResolveWithSchema(l.ElementType)
+	if !ok || len(l.Keys) == 0 {
+		return
+	}
+	if elem.Struct == nil {
+		v.errorf(path, "associative lists with keys must have struct elements")
+		return
+	}
+	for _, key := range l.Keys {
+		if !hasKeyField(s, elem.Struct, key) {
+			v.errorf(path, "key %q is not a field of the element type", key)
+		}
+	}
+}
+
+// hasKeyField returns true if key, a dot-separated path of field names,
+// refers to a field of st.
+func hasKeyField(s *Schema, st *Struct, key string) bool {
+	parts := strings.Split(key, ".")
+	for i, name := range parts {
+		var field *StructField
+		for j := range st.Fields {
+			if st.Fields[j].Name == name {
+				field = &st.Fields[j]
+			}
+		}
+		if field == nil {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		var a Atom
+		var ok bool
+		s, a, ok = s.ResolveWithSchema(field.Type)
+		if !ok || a.Struct == nil {
+			return false
+		}
+		st = a.Struct
+	}
+	return false
+}
+
+// checkRequiredCycle follows the required, non-nullable struct fields of the
+// named type, and reports an error if they lead back to the type being
+// checked. path lists the fields followed so far.
+func (v *schemaValidator) checkRequiredCycle(s *Schema, name string, path []string, visited map[string]bool) {
+	key := s.Package + "/" + name
+	if len(path) > 0 && s == v.schema && name == v.typeName {
+		v.errorf("", "required fields form a cycle: %v -> %v", strings.Join(path, " -> "), name)
+		return
+	}
+	if visited[key] {
+		return
+	}
+	visited[key] = true
+	t, ok := s.FindNamedType(name)
+	if !ok || t.Struct == nil {
+		return
+	}
+	v.checkRequiredFields(s, t.Struct, name, path, visited)
+}
+
+func (v *schemaValidator) checkRequiredFields(s *Schema, st *Struct, prefix string, path []string, visited map[string]bool) {
+	for _, f := range st.Fields {
+		// A null is enough to satisfy a required field, unless the
+		// field says otherwise.
+		if !f.Required || f.Nullable == nil || *f.Nullable {
+			continue
+		}
+		if f.Type.NamedType == nil {
+			if f.Type.Inlined.Struct != nil {
+				v.checkRequiredFields(s, f.Type.Inlined.Struct, prefix+"."+f.Name, path, visited)
+			}
+			continue
+		}
+		// Qualified references are followed under the name local to
+		// the schema defining the type.
+		s2, t, ok := s.FindNamedTypeWithSchema(*f.Type.NamedType)
+		if !ok || t.Struct == nil {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), prefix+"."+f.Name)
+		v.checkRequiredCycle(s2, t.Name, fieldPath, visited)
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		// expect is a substring of the error, or empty if the schema is
+		// valid.
+		expect string
+	}{{
+		name: "recursive type",
+		schema: `types:
+- name: node
+  struct:
+    fields:
+    - name: children
+      type:
+        list:
+          elementType:
+            namedType: node
+          elementRelationship: atomic
+    - name: parent
+      type:
+        namedType: node
+      required: true
+`,
+	}, {
+		name: "nested keys",
+		schema: `types:
+- name: ports
+  list:
+    elementType:
+      struct:
+        fields:
+        - name: port
+          type:
+            struct:
+              fields:
+              - name: number
+                type:
+                  scalar: integer
+    elementRelationship: associative
+    keys:
+    - port.number
+`,
+	}, {
+		name: "duplicate type",
+		schema: `types:
+- name: a
+  scalar: string
+- name: a
+  scalar: string
+`,
+		expect: "a: duplicate type name",
+	}, {
+		name: "empty atom",
+		schema: `types:
+- name: a
+`,
+		expect: "expected exactly one",
+	}, {
+		name: "unknown scalar",
+		schema: `types:
+- name: a
+  scalar: text
+`,
+		expect: `invalid scalar type "text"`,
+	}, {
+		name: "scalar union",
+		schema: `types:
+- name: a
+  scalar: integer|string
+`,
+	}, {
+		name: "repeated scalar kind",
+		schema: `types:
+- name: a
+  scalar: integer|string|integer
+`,
+		expect: `invalid scalar type "integer|string|integer"`,
+	}, {
+		name: "scalar union map keys",
+		schema: `types:
+- name: a
+  map:
+    elementType:
+      scalar: string
+    keyType: integer|string
+`,
+		expect: `invalid map key type "integer|string"`,
+	}, {
+		name: "dangling reference",
+		schema: `types:
+- name: a
+  struct:
+    fields:
+    - name: b
+      type:
+        map:
+          elementType:
+            namedType: b
+`,
+		expect: "a.b{}: no type found matching b",
+	}, {
+		name: "duplicate field",
+		schema: `types:
+- name: a
+  struct:
+    fields:
+    - name: b
+      type:
+        scalar: string
+    - name: b
+      type:
+        scalar: string
+`,
+		expect: "a.b: duplicate field name",
+	}, {
+		name: "duplicate former name",
+		schema: `types:
+- name: a
+  struct:
+    fields:
+    - name: b
+      type:
+        scalar: string
+    - name: c
+      type:
+        scalar: string
+      formerNames:
+      - b
+`,
+		expect: `a.c: duplicate field name "b"`,
+	}, {
+		name: "list without relationship",
+		schema: `types:
+- name: a
+  list:
+    elementType:
+      scalar: string
+`,
+		expect: `invalid element relationship "" for a list`,
+	}, {
+		name: "positional list",
+		schema: `types:
+- name: a
+  list:
+    elementType:
+      scalar: string
+    elementRelationship: positional
+`,
+	}, {
+		name: "positional list with keys",
+		schema: `types:
+- name: a
+  list:
+    elementType:
+      namedType: b
+    elementRelationship: positional
+    keys:
+    - name
+- name: b
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+`,
+		expect: "a: positional lists can't have keys",
+	}, {
+		name: "immutable associative list",
+		schema: `types:
+- name: a
+  list:
+    elementType:
+      scalar: string
+    elementRelationship: associative
+    immutable: true
+`,
+		expect: "a: only atomic lists may be immutable",
+	}, {
+		name: "unknown key",
+		schema: `types:
+- name: a
+  list:
+    elementType:
+      namedType: b
+    elementRelationship: associative
+    keys:
+    - name
+    - c.d
+- name: b
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+`,
+		expect: `key "c.d" is not a field`,
+	}, {
+		name: "required cycle",
+		schema: `types:
+- name: a
+  struct:
+    fields:
+    - name: b
+      type:
+        namedType: b
+      required: true
+      nullable: false
+- name: b
+  struct:
+    fields:
+    - name: inline
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              namedType: a
+            required: true
+            nullable: false
+      required: true
+      nullable: false
+`,
+		expect: "a: required fields form a cycle: a.b -> b.inline.a -> a",
+	}}
+
+	for _, tt := range cases {
+		err := mustParseSchema(t, tt.schema).Validate()
+		switch {
+		case tt.expect == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+		case tt.expect != "" && err == nil:
+			t.Errorf("%v: expected an error containing %q", tt.name, tt.expect)
+		case tt.expect != "" && !strings.Contains(err.Error(), tt.expect):
+			t.Errorf("%v: expected an error containing %q, got %v", tt.name, tt.expect, err)
+		}
+	}
+}
+
+func TestValidateRequiredCycleAcrossSchemas(t *testing.T) {
+	a := mustParseSchema(t, `package: example.com/a
+types:
+- name: example.com/a.A
+  struct:
+    fields:
+    - name: b
+      type:
+        namedType: example.com/b.example.com/b.B
+      required: true
+      nullable: false
+`)
+	b := mustParseSchema(t, `package: example.com/b
+types:
+- name: example.com/b.B
+  struct:
+    fields:
+    - name: a
+      type:
+        namedType: example.com/a.example.com/a.A
+      required: true
+      nullable: false
+`)
+	if _, err := NewRegistry(a, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := "required fields form a cycle: example.com/a.A.b -> example.com/b.B.a -> example.com/a.A"
+	if err := a.Validate(); err == nil || !strings.Contains(err.Error(), expect) {
+		t.Errorf("expected an error containing %q, got %v", expect, err)
+	}
+}
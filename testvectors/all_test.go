@@ -18,6 +18,12 @@ package testvectors
 
 import (
 	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/typed"
+	"sigs.k8s.io/structured-merge-diff/value"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestAll(t *testing.T) {
@@ -27,20 +33,43 @@ func TestAll(t *testing.T) {
 type implementation struct{}
 
 func (implementation) Test(t *testing.T, v *Vector, s SchemaDefinition) {
-	t.Skip("not implemented yet")
-
-	var implementationUnderTest inTreeImplementation
-	tmp := implementationUnderTest.diff(s, v.NewObject, v.LastObject)
-	got := implementationUnderTest.merge(s, v.LiveObject, tmp)
+	var sc schema.Schema
+	if err := yaml.Unmarshal([]byte(s), &sc); err != nil {
+		t.Fatalf("unable to unmarshal schema: %v", err)
+	}
+	if len(sc.Types) == 0 {
+		t.Fatalf("schema %v has no types", v.SchemaName)
+	}
+	parse := func(name string, obj YAMLObject) typed.TypedValue {
+		val, err := value.FromYAML([]byte(obj))
+		if err != nil {
+			t.Fatalf("unable to interpret %v yaml: %v\n%v", name, err, obj)
+		}
+		tv, err := typed.AsTyped(val, &sc, sc.Types[0].Name)
+		if err != nil {
+			t.Fatalf("invalid %v: %v", name, err)
+		}
+		return tv
+	}
+	last := parse("last object", v.LastObject)
+	live := parse("live object", v.LiveObject)
+	newObj := parse("new object", v.NewObject)
+	expected := parse("expected object", v.ExpectedObject)
 
-	if got != v.ExpectedObject {
-		t.Errorf("%v: did not get expected object", v.Name)
+	c, err := last.Compare(newObj)
+	if err != nil {
+		t.Fatalf("unable to compare the last and new objects: %v", err)
+	}
+	if !c.Removed.Empty() || len(v.ExpectedConflicts) > 0 {
+		t.Skip("not implemented yet: removals and conflicts")
 	}
-}
 
-// TODO: delete this. It's here as an illustration of the approach and isn't
-// necessary after we publish the necessary functions.
-type inTreeImplementation interface {
-	diff(s SchemaDefinition, a, b YAMLObject) YAMLObject
-	merge(s SchemaDefinition, a, b YAMLObject) YAMLObject
+	got, err := live.Merge(newObj)
+	if err != nil {
+		t.Fatalf("unable to merge the new object into the live object: %v", err)
+	}
+	// The order of list items matters, so compare the values as written.
+	if got.AsValue().HumanReadable() != expected.AsValue().HumanReadable() {
+		t.Errorf("%v: expected\n%v\ngot\n%v", v.Name, expected.AsValue().HumanReadable(), got.AsValue().HumanReadable())
+	}
 }
@@ -24,11 +24,16 @@ import (
 
 func init() {
 	Schemas["listordering-primitiveInlineList"] = SchemaDefinition(`
-type:
-  inlineList:
-    elementType:
-      inlineScalar: string
-  primitiveAssociative: true
+types:
+- name: type
+  struct:
+    fields:
+    - name: items
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
 `)
 
 	var tests []*Vector
@@ -24,8 +24,8 @@ import (
 // YAMLObject is an object encoded in YAML.
 type YAMLObject string
 
-// SchemaDefinition is an object schema. (TODO: get correct type; for now
-// assume this is a yaml-formatted string that can be deserialized.)
+// SchemaDefinition is an object schema: a YAML-encoded schema.Schema, whose
+// first type is the type of the objects.
 type SchemaDefinition string
 
 // Vector describes an individual test case. Test cases are exported for ease
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"math"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+// patterns caches compiled regular expressions, keyed by pattern.
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// validateConstraints checks v against the constraints of atom a, returning
+// one error per violated constraint.
+func (ef errorFormatter) validateConstraints(a schema.Atom, v value.Value) (errs ValidationErrors) {
+	c := a.Constraints
+	if c == nil || v.Null {
+		return nil
+	}
+
+	if f := formatOf(a); f != nil && v.List == nil && v.Map == nil {
+		if _, err := f.Parse(v); err != nil {
+			errs = append(errs, ef.errorf("%v is not a valid %v: %v", v.HumanReadable(), c.Format, err)...)
+		}
+	}
+
+	if len(c.Enum) > 0 && v.List == nil && v.Map == nil {
+		errs = append(errs, ef.validateEnum(a, v)...)
+	}
+
+	if v.String != nil {
+		s := string(*v.String)
+		length := int64(utf8.RuneCountInString(s))
+		if c.MinLength != nil && length < *c.MinLength {
+			errs = append(errs, ef.errorf("%v is shorter than the minimum length %v", v.HumanReadable(), *c.MinLength)...)
+		}
+		if c.MaxLength != nil && length > *c.MaxLength {
+			errs = append(errs, ef.errorf("%v is longer than the maximum length %v", v.HumanReadable(), *c.MaxLength)...)
+		}
+		if c.Pattern != "" {
+			re, err := compilePattern(c.Pattern)
+			if err != nil {
+				errs = append(errs, ef.prefixError("schema error: invalid pattern: ", err)...)
+			} else if !re.MatchString(s) {
+				errs = append(errs, ef.errorf("%v does not match pattern %q", v.HumanReadable(), c.Pattern)...)
+			}
+		}
+	}
+
+	if n, ok := numericValue(v); ok {
+		if c.Minimum != nil && n < *c.Minimum {
+			errs = append(errs, ef.errorf("%v is less than the minimum %v", v.HumanReadable(), *c.Minimum)...)
+		}
+		if c.Maximum != nil && n > *c.Maximum {
+			errs = append(errs, ef.errorf("%v is greater than the maximum %v", v.HumanReadable(), *c.Maximum)...)
+		}
+		if c.MultipleOf != nil && *c.MultipleOf != 0 {
+			q := n / *c.MultipleOf
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				errs = append(errs, ef.errorf("%v is not a multiple of %v", v.HumanReadable(), *c.MultipleOf)...)
+			}
+		}
+	}
+
+	if v.List != nil {
+		n := int64(len(v.List.Items))
+		if c.MinItems != nil && n < *c.MinItems {
+			errs = append(errs, ef.errorf("list has %v items, fewer than the minimum %v", n, *c.MinItems)...)
+		}
+		if c.MaxItems != nil && n > *c.MaxItems {
+			errs = append(errs, ef.errorf("list has %v items, more than the maximum %v", n, *c.MaxItems)...)
+		}
+	}
+
+	if v.Map != nil && c.MaxProperties != nil {
+		if n := int64(len(v.Map.Items)); n > *c.MaxProperties {
+			errs = append(errs, ef.errorf("map has %v items, more than the maximum %v", n, *c.MaxProperties)...)
+		}
+	}
+
+	return errs
+}
+
+func (ef errorFormatter) validateEnum(a schema.Atom, v value.Value) ValidationErrors {
+	for _, e := range a.Constraints.Enum {
+		allowed, err := value.FromUnstructured(e)
+		if err != nil {
+			return ef.prefixError("schema error: invalid enum value: ", err)
+		}
+		if f := formatOf(a); f != nil {
+			if f.equal(allowed, v) {
+				return nil
+			}
+		} else if a.Scalar != nil {
+			if scalarEqual(*a.Scalar, allowed, v) {
+				return nil
+			}
+		} else if value.Equals(allowed, v) {
+			return nil
+		}
+	}
+	return ef.errorf("%v is not one of the allowed values", v.HumanReadable())
+}
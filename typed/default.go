@@ -0,0 +1,229 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+type defaultingWalker struct {
+	errorFormatter
+	value    value.Value
+	schema   *schema.Schema
+	typeRef  schema.TypeRef
+	resolver TypeResolver
+
+	// Every path which is set to a default is added here.
+	defaulted *fieldpath.Set
+
+	// output of the defaulting operation
+	out value.Value
+}
+
+func (w *defaultingWalker) applyDefaults() ValidationErrors {
+	w.out = w.value
+	s, a, errs := w.resolveSchema(w.schema, w.typeRef)
+	if len(errs) > 0 {
+		return errs
+	}
+	w.schema = s
+	return handleAtom(a, w)
+}
+
+func (w *defaultingWalker) prepareDescent(pe fieldpath.PathElement, tr schema.TypeRef, v value.Value) *defaultingWalker {
+	w2 := *w
+	w2.errorFormatter.descend(pe)
+	w2.typeRef = tr
+	w2.value = v
+	return &w2
+}
+
+// defaultValue converts a default from the schema into a value, which must be
+// of type tr; pe is where it's going.
+func (w *defaultingWalker) defaultValue(d interface{}, pe fieldpath.PathElement, tr schema.TypeRef) (value.Value, ValidationErrors) {
+	v, err := value.FromUnstructured(d)
+	if err != nil {
+		return value.Value{}, w.prefixError("schema error: invalid default: ", err)
+	}
+	vw := validatingObjectWalker{
+		errorFormatter: w.errorFormatter,
+		value:          v,
+		schema:         w.schema,
+		typeRef:        tr,
+		resolver:       w.resolver,
+	}
+	vw.descend(pe)
+	if errs := vw.validate(); len(errs) > 0 {
+		for i := range errs {
+			errs[i].ErrorMessage = "schema error: invalid default: " + errs[i].ErrorMessage
+		}
+		return value.Value{}, errs
+	}
+	return v, nil
+}
+
+func (w *defaultingWalker) doScalar(t schema.Scalar) ValidationErrors { return nil }
+
+func (w *defaultingWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "struct")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	out := &value.Map{}
+	// Keep the original order, and put defaults at the end.
+	for _, item := range m.Items {
+		out.Set(item.Name, item.Value)
+	}
+	for i := range t.Fields {
+		f := t.Fields[i]
+		child, err := structFieldItem(m, f)
+		if err != nil {
+			w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &f.Name}, f.Type, value.Value{})
+			errs = append(errs, w2.error(err)...)
+			continue
+		}
+		ok := child != nil
+		// Fields found under a former name keep it.
+		name := f.Name
+		var v value.Value
+		if ok {
+			v = child.Value
+			name = child.Name
+		} else if f.Default != nil {
+			var newErrs ValidationErrors
+			v, newErrs = w.defaultValue(f.Default, fieldpath.PathElement{FieldName: &f.Name}, f.Type)
+			if len(newErrs) > 0 {
+				errs = append(errs, newErrs...)
+				continue
+			}
+		} else {
+			continue
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &f.Name}, f.Type, v)
+		if !ok {
+			w.defaulted.Insert(w2.path)
+		}
+		if newErrs := w2.applyDefaults(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Set(name, w2.out)
+	}
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *defaultingWalker) doList(t schema.List) (errs ValidationErrors) {
+	list, err := listValue(w.value)
+	if err != nil {
+		return w.error(err)
+	}
+	if list == nil {
+		return nil
+	}
+
+	out := &value.List{}
+	for i, child := range list.Items {
+		i := i
+		defaulted := false
+		if child.Null && t.ElementDefault != nil {
+			var newErrs ValidationErrors
+			child, newErrs = w.defaultValue(t.ElementDefault, fieldpath.PathElement{Index: &i}, t.ElementType)
+			if len(newErrs) > 0 {
+				errs = append(errs, newErrs...)
+				continue
+			}
+			defaulted = true
+		}
+		pe, err := listItemToPathElement(w.schema, t, i, child)
+		if err != nil {
+			errs = append(errs, w.errorf("element %v: %v", i, err.Error())...)
+			continue
+		}
+		w2 := w.prepareDescent(pe, t.ElementType, child)
+		if defaulted {
+			w.defaulted.Insert(w2.path)
+		}
+		if newErrs := w2.applyDefaults(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Items = append(out.Items, w2.out)
+	}
+	w.out = value.Value{List: out}
+	return errs
+}
+
+func (w *defaultingWalker) doMap(t schema.Map) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "map")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	out := &value.Map{}
+	for _, item := range m.Items {
+		item := item
+		child := item.Value
+		defaulted := false
+		if child.Null && t.ElementDefault != nil {
+			var newErrs ValidationErrors
+			child, newErrs = w.defaultValue(t.ElementDefault, fieldpath.PathElement{FieldName: &item.Name}, t.ElementType)
+			if len(newErrs) > 0 {
+				errs = append(errs, newErrs...)
+				continue
+			}
+			defaulted = true
+		}
+		key, err := canonicalMapKey(t, item.Name)
+		if err != nil {
+			errs = append(errs, w.error(err)...)
+			continue
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &key}, t.ElementType, child)
+		if defaulted {
+			w.defaulted.Insert(w2.path)
+		}
+		if newErrs := w2.applyDefaults(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Set(item.Name, w2.out)
+	}
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *defaultingWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
+	if t.ElementRelationship == schema.Lookup && !w.value.Null {
+		w.schema, w.typeRef, errs = w.lookupType(w.resolver, w.schema, w.value)
+		if len(errs) > 0 {
+			return errs
+		}
+		return w.applyDefaults()
+	}
+	// There's nothing to default in other untyped data.
+	return nil
+}
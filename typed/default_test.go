@@ -0,0 +1,293 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+
+	"gopkg.in/yaml.v2"
+)
+
+type defaultTestCase struct {
+	name         string
+	rootTypeName string
+	schema       string
+	triplets     []defaultTriplet
+}
+
+type defaultTriplet struct {
+	object    string
+	defaulted string
+	// set is the result of ToFieldSet on the defaulted object.
+	set *fieldpath.Set
+}
+
+var defaultCases = []defaultTestCase{{
+	name:         "struct fields",
+	rootTypeName: "service",
+	schema: `types:
+- name: service
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: type
+      type:
+        scalar: string
+      default: ClusterIP
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - name
+    - name: options
+      type:
+        namedType: options
+      default: {}
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+          elementDefault: ""
+- name: port
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: protocol
+      type:
+        scalar: string
+      default: TCP
+- name: options
+  struct:
+    fields:
+    - name: timeout
+      type:
+        scalar: integer
+      default: 30
+    - name: retries
+      type:
+        scalar: integer
+`,
+	triplets: []defaultTriplet{{
+		`{"name":"a","type":"NodePort","options":{"timeout":1}}`,
+		`{"name":"a","type":"NodePort","options":{"timeout":1}}`,
+		_NS(_P("name"), _P("type"), _P("options", "timeout")),
+	}, {
+		`{"name":"a"}`,
+		`{"name":"a","type":"ClusterIP","options":{"timeout":30}}`,
+		_NS(_P("name")),
+	}, {
+		`{"options":{"retries":3}}`,
+		`{"options":{"retries":3,"timeout":30},"type":"ClusterIP"}`,
+		_NS(_P("options", "retries")),
+	}, {
+		`{"type":"a","options":{},"ports":[{"name":"http"},{"name":"dns","protocol":"UDP"}]}`,
+		`{"type":"a","options":{"timeout":30},"ports":[{"name":"http","protocol":"TCP"},{"name":"dns","protocol":"UDP"}]}`,
+		_NS(
+			_P("type"),
+			_P("ports", _KBF("name", _SV("http")), "name"),
+			_P("ports", _KBF("name", _SV("dns")), "name"),
+			_P("ports", _KBF("name", _SV("dns")), "protocol"),
+		),
+	}, {
+		`{"type":"a","options":null,"labels":{"a":"b","c":null}}`,
+		`{"type":"a","options":null,"labels":{"a":"b","c":""}}`,
+		_NS(_P("type"), _P("labels", "a")),
+	}},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      default: 1
+      formerNames:
+      - count
+`,
+	triplets: []defaultTriplet{{
+		`{"count":3}`,
+		`{"count":3}`,
+		_NS(_P("replicas")),
+	}, {
+		`{}`,
+		`{"replicas":1}`,
+		_NS(),
+	}},
+}}
+
+func (tt defaultTestCase) test(t *testing.T) {
+	var s schema.Schema
+	err := yaml.Unmarshal([]byte(tt.schema), &s)
+	if err != nil {
+		t.Fatalf("unable to unmarshal schema: %v", err)
+	}
+
+	for i, triplet := range tt.triplets {
+		triplet := triplet
+		t.Run(fmt.Sprintf("%v-%v", tt.name, i), func(t *testing.T) {
+			t.Parallel()
+			obj, err := value.FromYAML([]byte(triplet.object))
+			if err != nil {
+				t.Fatalf("unable to interpret yaml: %v\n%v", err, triplet.object)
+			}
+			expect, err := value.FromYAML([]byte(triplet.defaulted))
+			if err != nil {
+				t.Fatalf("unable to interpret yaml: %v\n%v", err, triplet.defaulted)
+			}
+
+			got, err := AsTypedUnvalidated(obj, &s, tt.rootTypeName).Default()
+			if err != nil {
+				t.Fatalf("got errors: %v", err)
+			}
+			if !reflect.DeepEqual(got.value.ToUnstructured(true), expect.ToUnstructured(true)) {
+				t.Errorf("Expected\n%v\nbut got\n%v\n",
+					expect.HumanReadable(), got.value.HumanReadable(),
+				)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("defaulted object is invalid: %v", err)
+			}
+
+			fs, err := got.ToFieldSet()
+			if err != nil {
+				t.Fatalf("got validation errors: %v", err)
+			}
+			if !fs.Equals(triplet.set) {
+				t.Errorf("wanted\n%s\ngot\n%s\n", triplet.set, fs)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	for _, tt := range defaultCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.test(t)
+		})
+	}
+}
+
+func TestMergeKeepsDefaulted(t *testing.T) {
+	s := mustSchema(t, defaultCases[0].schema)
+	lhs, err := AsTypedUnvalidated(mustValue(t, `{"name":"a"}`), s, "service").Default()
+	if err != nil {
+		t.Fatalf("got errors: %v", err)
+	}
+	for _, tt := range []struct {
+		rhs string
+		set *fieldpath.Set
+	}{{
+		`{"name":"b"}`,
+		_NS(_P("name")),
+	}, {
+		// Setting a defaulted field makes it owned, even to the
+		// same value.
+		`{"options":{"timeout":30}}`,
+		_NS(_P("name"), _P("options", "timeout")),
+	}} {
+		rhs := AsTypedUnvalidated(mustValue(t, tt.rhs), s, "service")
+		merged, err := lhs.Merge(rhs)
+		if err != nil {
+			t.Fatalf("got merge errors: %v", err)
+		}
+		c, err := lhs.Compare(rhs)
+		if err != nil {
+			t.Fatalf("got compare errors: %v", err)
+		}
+		for _, got := range []TypedValue{merged, c.Merged} {
+			fs, err := got.ToFieldSet()
+			if err != nil {
+				t.Fatalf("got validation errors: %v", err)
+			}
+			if !fs.Equals(tt.set) {
+				t.Errorf("%v: wanted\n%s\ngot\n%s\n", tt.rhs, tt.set, fs)
+			}
+		}
+	}
+
+	deep := lhs.WithMaxDepth(5)
+	merged, err := deep.Merge(AsTypedUnvalidated(mustValue(t, `{}`), s, "service"))
+	if err != nil {
+		t.Fatalf("got merge errors: %v", err)
+	}
+	if merged.maxDepth != 5 {
+		t.Errorf("expected the merged object to keep a maximum depth of 5, got %v", merged.maxDepth)
+	}
+}
+
+func TestDefaultInvalid(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      default: 5
+    - name: ports
+      type:
+        list:
+          elementType:
+            scalar: integer
+          elementRelationship: atomic
+          elementDefault: http
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+          elementDefault:
+            a: b
+`)
+	cases := []struct {
+		object, path string
+	}{
+		{`{}`, ".name"},
+		{`{"name":"a","ports":[null]}`, ".ports[0]"},
+		{`{"name":"a","labels":{"a":null}}`, ".labels.a"},
+	}
+	for _, tt := range cases {
+		_, err := AsTypedUnvalidated(mustValue(t, tt.object), s, "root").Default()
+		if err == nil {
+			t.Errorf("%v: expected an error for an invalid default", tt.object)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.path+": schema error: invalid default") {
+			t.Errorf("%v: expected an invalid default at %v, got %v", tt.object, tt.path, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+// Format gives meaning to the values of scalars declared with a format (see
+// schema.Constraints.Format), so that e.g. the quantities "1000m" and "1" are
+// recognized as equal. Values which don't parse are rejected by validation.
+type Format struct {
+	// Parse checks that v is a valid value of the format, and returns
+	// what it means, e.g. a time.Time. It's required.
+	Parse func(v value.Value) (interface{}, error)
+	// Canonicalize returns the canonical form of a parsed value; values
+	// which mean the same thing must have the same canonical form. It's
+	// required.
+	Canonicalize func(parsed interface{}) value.Value
+	// Equal returns true if two parsed values mean the same thing. If it's
+	// nil, their canonical forms are compared.
+	Equal func(lhs, rhs interface{}) bool
+}
+
+var formats = struct {
+	sync.RWMutex
+	m map[string]Format
+}{m: map[string]Format{}}
+
+// RegisterFormat makes f available under the given name, replacing the
+// format registered under that name, if any. The built-in formats are:
+//  * `date-time`: RFC 3339 timestamps, equal if they're the same instant;
+//  * `duration`: durations as accepted by time.ParseDuration, e.g. "1m" and
+//    "60s";
+//  * `quantity`: Kubernetes resource quantities, e.g. "1000m" and "1", or
+//    "1Ki" and "1024"; plain numbers are accepted too.
+func RegisterFormat(name string, f Format) {
+	if f.Parse == nil || f.Canonicalize == nil {
+		panic(fmt.Sprintf("format %q must have Parse and Canonicalize functions", name))
+	}
+	formats.Lock()
+	defer formats.Unlock()
+	formats.m[name] = f
+}
+
+// LookupFormat returns the format registered under the given name.
+func LookupFormat(name string) (Format, bool) {
+	formats.RLock()
+	defer formats.RUnlock()
+	f, ok := formats.m[name]
+	return f, ok
+}
+
+// formatOf returns the format of the scalar atom a, or nil if it has none.
+// Formats which aren't registered are ignored, as in JSON Schema.
+func formatOf(a schema.Atom) *Format {
+	if a.Scalar == nil || a.Constraints == nil || a.Constraints.Format == "" {
+		return nil
+	}
+	f, ok := LookupFormat(a.Constraints.Format)
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+// equal compares two values of the format. Values which don't parse are
+// only equal to identical values.
+func (f *Format) equal(lhs, rhs value.Value) bool {
+	l, lerr := f.Parse(lhs)
+	r, rerr := f.Parse(rhs)
+	if lerr != nil || rerr != nil {
+		return value.Equals(lhs, rhs)
+	}
+	if f.Equal != nil {
+		return f.Equal(l, r)
+	}
+	return value.Equals(f.Canonicalize(l), f.Canonicalize(r))
+}
+
+// canonical returns the canonical form of v, or v itself if it doesn't
+// parse.
+func (f *Format) canonical(v value.Value) value.Value {
+	parsed, err := f.Parse(v)
+	if err != nil {
+		return v
+	}
+	return f.Canonicalize(parsed)
+}
+
+func init() {
+	RegisterFormat("date-time", Format{
+		Parse: func(v value.Value) (interface{}, error) {
+			if v.String == nil {
+				return nil, errors.New("expected an RFC 3339 timestamp string")
+			}
+			return time.Parse(time.RFC3339, string(*v.String))
+		},
+		Canonicalize: func(parsed interface{}) value.Value {
+			return value.StringValue(parsed.(time.Time).UTC().Format(time.RFC3339Nano))
+		},
+		Equal: func(lhs, rhs interface{}) bool {
+			return lhs.(time.Time).Equal(rhs.(time.Time))
+		},
+	})
+	RegisterFormat("duration", Format{
+		Parse: func(v value.Value) (interface{}, error) {
+			if v.String == nil {
+				return nil, errors.New("expected a duration string")
+			}
+			return time.ParseDuration(string(*v.String))
+		},
+		Canonicalize: func(parsed interface{}) value.Value {
+			return value.StringValue(parsed.(time.Duration).String())
+		},
+	})
+	RegisterFormat("quantity", Format{
+		Parse: func(v value.Value) (interface{}, error) {
+			switch {
+			case v.String != nil:
+				return parseQuantity(string(*v.String))
+			case v.Int != nil:
+				return new(big.Rat).SetInt64(int64(*v.Int)), nil
+			case v.Float != nil:
+				if r, ok := new(big.Rat).SetString(fmt.Sprint(float64(*v.Float))); ok {
+					return r, nil
+				}
+			}
+			return nil, errors.New("expected a quantity")
+		},
+		Canonicalize: func(parsed interface{}) value.Value {
+			return value.StringValue(decimalString(parsed.(*big.Rat)))
+		},
+		Equal: func(lhs, rhs interface{}) bool {
+			return lhs.(*big.Rat).Cmp(rhs.(*big.Rat)) == 0
+		},
+	})
+}
+
+// quantitySuffixes maps the suffixes of quantities to their multipliers.
+var quantitySuffixes = map[string]*big.Rat{
+	"":   big.NewRat(1, 1),
+	"n":  big.NewRat(1, 1000000000),
+	"u":  big.NewRat(1, 1000000),
+	"m":  big.NewRat(1, 1000),
+	"k":  big.NewRat(1000, 1),
+	"M":  big.NewRat(1000000, 1),
+	"G":  powerOfTen(9),
+	"T":  powerOfTen(12),
+	"P":  powerOfTen(15),
+	"E":  powerOfTen(18),
+	"Ki": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 10)),
+	"Mi": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 20)),
+	"Gi": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 30)),
+	"Ti": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 40)),
+	"Pi": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 50)),
+	"Ei": new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 60)),
+}
+
+// parseQuantity parses a Kubernetes resource quantity: a signed decimal
+// number, followed by an SI suffix (e.g. "m", "k"), a binary suffix (e.g.
+// "Ki") or a decimal exponent (e.g. "e3").
+func parseQuantity(s string) (*big.Rat, error) {
+	end := 0
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	digits := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+		if s[end] != '.' {
+			digits++
+		}
+		end++
+	}
+	if digits == 0 || strings.Count(s[:end], ".") > 1 {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	number, ok := new(big.Rat).SetString(s[:end])
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	suffix := s[end:]
+	if multiplier, ok := quantitySuffixes[suffix]; ok {
+		return number.Mul(number, multiplier), nil
+	}
+	if len(suffix) > 1 && (suffix[0] == 'e' || suffix[0] == 'E') {
+		if exp, err := strconv.ParseInt(suffix[1:], 10, 64); err == nil && exp >= -18 && exp <= 18 {
+			if exp < 0 {
+				return number.Quo(number, powerOfTen(-exp)), nil
+			}
+			return number.Mul(number, powerOfTen(exp)), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid quantity %q: unknown suffix %q", s, suffix)
+}
+
+func powerOfTen(exp int64) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil))
+}
+
+// decimalString formats r, which must have a finite decimal expansion (as
+// quantities do), exactly and without trailing zeros.
+func decimalString(r *big.Rat) string {
+	places := 0
+	scaled := new(big.Rat).Set(r)
+	ten := big.NewRat(10, 1)
+	for !scaled.IsInt() && places < 64 {
+		scaled.Mul(scaled, ten)
+		places++
+	}
+	return r.FloatString(places)
+}
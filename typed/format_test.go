@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+func TestBuiltinFormats(t *testing.T) {
+	cases := []struct {
+		format string
+		// equal lists groups of values which mean the same thing,
+		// starting with the canonical form; values of different groups
+		// are different.
+		equal [][]string
+		// invalid lists values which don't parse.
+		invalid []string
+	}{{
+		format: "date-time",
+		equal: [][]string{
+			{`"2018-10-01T12:00:00Z"`, `"2018-10-01T14:00:00+02:00"`, `"2018-10-01T12:00:00.000Z"`},
+			{`"2018-10-01T12:00:00.5Z"`, `"2018-10-01T07:00:00.5-05:00"`},
+		},
+		invalid: []string{`"2018-10-01"`, `"yesterday"`, `1538395200`},
+	}, {
+		format: "duration",
+		equal: [][]string{
+			{`"1m0s"`, `"60s"`, `"1m"`, `"60000ms"`},
+			{`"1h30m0s"`, `"90m"`, `"1.5h"`},
+			{`"0s"`, `"0"`},
+		},
+		invalid: []string{`"1d"`, `"fast"`, `60`},
+	}, {
+		format: "quantity",
+		equal: [][]string{
+			{`"1"`, `"1000m"`, `1`, `1.0`, `"1e0"`, `"+1"`},
+			{`"0.1"`, `"100m"`, `0.1`, `"1e-1"`, `"100000u"`},
+			{`"1024"`, `"1Ki"`, `"1.024k"`, `1024`},
+			{`"1500000000"`, `"1.5G"`, `"1500M"`, `"15e8"`},
+			{`"-2"`, `"-2000m"`},
+		},
+		invalid: []string{`""`, `"m"`, `"1.2.3"`, `"1Kb"`, `"1 Ki"`, `"e3"`, `true`},
+	}}
+
+	for _, tt := range cases {
+		f, ok := LookupFormat(tt.format)
+		if !ok {
+			t.Fatalf("format %v is not registered", tt.format)
+		}
+		var groups [][]value.Value
+		for _, group := range tt.equal {
+			var values []value.Value
+			for _, y := range group {
+				values = append(values, mustValue(t, y))
+			}
+			groups = append(groups, values)
+		}
+		for i, group := range groups {
+			canonical := group[0]
+			for _, v := range group {
+				if got := f.canonical(v); !value.Equals(got, canonical) {
+					t.Errorf("%v: expected %v to be canonicalized to %v, got %v",
+						tt.format, v.HumanReadable(), canonical.HumanReadable(), got.HumanReadable())
+				}
+				for j, other := range groups {
+					for _, w := range other {
+						if got := f.equal(v, w); got != (i == j) {
+							t.Errorf("%v: expected %v == %v to be %v", tt.format, v.HumanReadable(), w.HumanReadable(), i == j)
+						}
+					}
+				}
+			}
+		}
+		for _, y := range tt.invalid {
+			v := mustValue(t, y)
+			if _, err := f.Parse(v); err == nil {
+				t.Errorf("%v: expected %v to be invalid", tt.format, y)
+			}
+		}
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("test-lowercase", Format{
+		Parse: func(v value.Value) (interface{}, error) {
+			if v.String == nil {
+				return nil, errors.New("expected a string")
+			}
+			return strings.ToLower(string(*v.String)), nil
+		},
+		Canonicalize: func(parsed interface{}) value.Value {
+			return value.StringValue(parsed.(string))
+		},
+	})
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: host
+      type:
+        scalar: string
+        constraints:
+          format: test-lowercase
+    - name: other
+      type:
+        scalar: string
+        constraints:
+          format: unregistered
+`)
+	lhs := AsTypedUnvalidated(mustValue(t, `{"host":"Example.COM","other":"a"}`), s, "root")
+	rhs := AsTypedUnvalidated(mustValue(t, `{"host":"example.com","other":"A"}`), s, "root")
+	c, err := lhs.Compare(rhs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expect := _NS(_P("other")); !c.Modified.Equals(expect) {
+		t.Errorf("expected modified fields\n%v\ngot\n%v", expect, c.Modified)
+	}
+}
@@ -19,6 +19,8 @@ package typed
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"sigs.k8s.io/structured-merge-diff/fieldpath"
@@ -58,6 +60,10 @@ func (errs ValidationErrors) Error() string {
 // boundary, since it's weird to have functions not return a plain error type.
 type errorFormatter struct {
 	path fieldpath.Path
+
+	// maxDepth, if positive, is the length of the longest path the walkers
+	// descend to; deeper values are reported as errors.
+	maxDepth int
 }
 
 func (ef *errorFormatter) descend(pe fieldpath.PathElement) {
@@ -85,6 +91,13 @@ func (ef errorFormatter) prefixError(prefix string, err error) ValidationErrors
 	}}
 }
 
+func prefixErrors(prefix string, errs ValidationErrors) ValidationErrors {
+	for i := range errs {
+		errs[i].ErrorMessage = prefix + errs[i].ErrorMessage
+	}
+	return errs
+}
+
 type atomHandler interface {
 	doScalar(schema.Scalar) ValidationErrors
 	doStruct(schema.Struct) ValidationErrors
@@ -95,12 +108,22 @@ type atomHandler interface {
 	errorf(msg string, args ...interface{}) ValidationErrors
 }
 
-func resolveSchema(s *schema.Schema, tr schema.TypeRef, ah atomHandler) ValidationErrors {
-	a, ok := s.Resolve(tr)
+// resolveSchema looks up tr in s, following references to types of other
+// schemas in the same registry. It returns the schema the type was found in,
+// which any references nested in the atom are relative to. Since the walkers
+// call it at every level, it also enforces the maximum depth.
+func (ef errorFormatter) resolveSchema(s *schema.Schema, tr schema.TypeRef) (*schema.Schema, schema.Atom, ValidationErrors) {
+	if ef.maxDepth > 0 && len(ef.path) > ef.maxDepth {
+		return nil, schema.Atom{}, ef.errorf("exceeded the maximum depth of %v", ef.maxDepth)
+	}
+	s2, a, ok := s.ResolveWithSchema(tr)
 	if !ok {
-		return ah.errorf("schema error: no type found matching: %v", *tr.NamedType)
+		return nil, schema.Atom{}, ef.errorf("schema error: no type found matching: %v", *tr.NamedType)
 	}
+	return s2, a, nil
+}
 
+func handleAtom(a schema.Atom, ah atomHandler) ValidationErrors {
 	switch {
 	case a.Scalar != nil:
 		return ah.doScalar(*a.Scalar)
@@ -121,22 +144,105 @@ func (ef errorFormatter) validateScalar(t schema.Scalar, v *value.Value, prefix
 	if v == nil {
 		return nil
 	}
-	switch t {
-	case schema.Numeric:
-		if v.Float == nil && v.Int == nil {
-			// TODO: should the schema separate int and float?
-			return ef.errorf("%vexpected numeric (int or float), got %v", prefix, v.HumanReadable())
+	// Unions accept a value of any of their kinds.
+	var expected []string
+	for _, k := range t.Kinds() {
+		if scalarKindAccepts(k, *v) {
+			return nil
 		}
+		expected = append(expected, scalarKindDescription(k))
+	}
+	return ef.errorf("%vexpected %v, got %v", prefix, strings.Join(expected, " or "), v.HumanReadable())
+}
+
+// scalarKindAccepts returns true if v is a valid value of the scalar kind k,
+// which must not be a union.
+func scalarKindAccepts(k schema.Scalar, v value.Value) bool {
+	switch k {
+	case schema.Numeric, schema.Float:
+		return v.Float != nil || v.Int != nil
+	case schema.Integer:
+		return v.Int != nil || (v.Float != nil && isIntegral(float64(*v.Float)))
 	case schema.String:
-		if v.String == nil {
-			return ef.errorf("%vexpected string, got %v", prefix, v.HumanReadable())
+		return v.String != nil
+	case schema.Boolean:
+		return v.Boolean != nil
+	}
+	return true
+}
+
+func scalarKindDescription(k schema.Scalar) string {
+	switch k {
+	case schema.Numeric, schema.Float:
+		return "numeric (int or float)"
+	}
+	return string(k)
+}
+
+func isIntegral(f float64) bool {
+	return !math.IsInf(f, 0) && f == math.Trunc(f)
+}
+
+// canonicalMapKey checks that key is valid for the key type of t, and returns
+// its canonical spelling, so that e.g. the integer keys "01" and "1" are
+// recognized as the same key.
+func canonicalMapKey(t schema.Map, key string) (string, error) {
+	switch t.KeyType {
+	case "", schema.String:
+		return key, nil
+	case schema.Integer:
+		if i, err := strconv.ParseInt(key, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		if f, err := strconv.ParseFloat(key, 64); err == nil && isIntegral(f) {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
 		}
+		return "", fmt.Errorf("expected integer key, got %q", key)
+	case schema.Numeric, schema.Float:
+		if i, err := strconv.ParseInt(key, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		if f, err := strconv.ParseFloat(key, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return strconv.FormatFloat(f, 'g', -1, 64), nil
+		}
+		return "", fmt.Errorf("expected numeric key, got %q", key)
 	case schema.Boolean:
-		if v.Boolean == nil {
-			return ef.errorf("%vexpected boolean, got %v", prefix, v.HumanReadable())
+		if b, err := strconv.ParseBool(key); err == nil {
+			return strconv.FormatBool(b), nil
 		}
+		return "", fmt.Errorf("expected boolean key, got %q", key)
 	}
-	return nil
+	return "", fmt.Errorf("schema error: invalid map key type %q", t.KeyType)
+}
+
+// scalarEqual compares two values of scalar type t. Numbers are compared by
+// value, so that 1 and 1.0 are equal when the schema says they're numbers.
+// Values of different kinds (e.g. 80 and "80") are never equal.
+func scalarEqual(t schema.Scalar, lhs, rhs value.Value) bool {
+	for _, k := range t.Kinds() {
+		switch k {
+		case schema.Numeric, schema.Integer, schema.Float:
+			if lhs.Int != nil && rhs.Int != nil {
+				return *lhs.Int == *rhs.Int
+			}
+			l, lok := numericValue(lhs)
+			r, rok := numericValue(rhs)
+			if lok && rok {
+				return l == r
+			}
+		}
+	}
+	return value.Equals(lhs, rhs)
+}
+
+func numericValue(v value.Value) (float64, bool) {
+	switch {
+	case v.Int != nil:
+		return float64(*v.Int), true
+	case v.Float != nil:
+		return float64(*v.Float), true
+	}
+	return 0, false
 }
 
 // Returns the list, or an error. Reminder: nil is a valid list and might be returned.
@@ -176,7 +282,7 @@ func (ef errorFormatter) rejectExtraStructFields(m *value.Map, allowedNames map[
 	return errs
 }
 
-func keyedAssociativeListItemToPathElement(list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
+func keyedAssociativeListItemToPathElement(s *schema.Schema, list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
 	pe := fieldpath.PathElement{}
 	if child.Null {
 		// For now, the keys are required which means that null entries
@@ -186,51 +292,182 @@ func keyedAssociativeListItemToPathElement(list schema.List, index int, child va
 	if child.Map == nil {
 		return pe, errors.New("associative list with keys may not have non-map elements")
 	}
-	for _, fieldName := range list.Keys {
-		var fieldValue value.Value
-		field, ok := child.Map.Get(fieldName)
-		if ok {
-			fieldValue = field.Value
-		} else {
-			// Treat keys as required.
-			return pe, errors.New("associative list with keys has an element that omits key field " + fieldName)
+	for _, key := range list.Keys {
+		fieldValue, err := keyFieldValue(s, list.ElementType, child, key)
+		if err != nil {
+			return pe, err
 		}
 		pe.Key = append(pe.Key, value.Field{
-			Name:  fieldName,
+			Name:  key,
 			Value: fieldValue,
 		})
 	}
 	return pe, nil
 }
 
-func setItemToPathElement(list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
+// keyFieldValue finds the value of the given key of a list element. The key
+// may be a dot-separated path into nested struct fields. Missing fields take
+// their default from the element's schema, if it has one.
+func keyFieldValue(s *schema.Schema, tr schema.TypeRef, child value.Value, key string) (value.Value, error) {
+	v := child
+	for _, fieldName := range strings.Split(key, ".") {
+		var f *schema.StructField
+		if s != nil {
+			var a schema.Atom
+			var ok bool
+			s, a, ok = s.ResolveWithSchema(tr)
+			if ok && a.Struct != nil {
+				f = findStructField(a.Struct, fieldName)
+			}
+		}
+		if f != nil {
+			tr = f.Type
+		}
+
+		if v.Map != nil {
+			field, ok := v.Map.Get(fieldName)
+			if f != nil {
+				var err error
+				if field, err = structFieldItem(v.Map, *f); err != nil {
+					return value.Value{}, fmt.Errorf("associative list key %v: %v", key, err)
+				}
+				ok = field != nil
+			}
+			if ok {
+				v = field.Value
+				continue
+			}
+		} else if !v.Null {
+			return value.Value{}, fmt.Errorf("associative list key %v traverses a non-map value", key)
+		}
+		if f == nil || f.Default == nil {
+			// Treat keys as required.
+			return value.Value{}, errors.New("associative list with keys has an element that omits key field " + key)
+		}
+		d, err := value.FromUnstructured(f.Default)
+		if err != nil {
+			return value.Value{}, fmt.Errorf("schema error: invalid default for key field %v: %v", key, err)
+		}
+		v = d
+	}
+	return v, nil
+}
+
+// structFieldItem finds field f in m, under its current name or one of its
+// former names. It returns nil if the field is missing, and an error if it's
+// set under more than one name.
+func structFieldItem(m *value.Map, f schema.StructField) (*value.Field, error) {
+	if m == nil {
+		return nil, nil
+	}
+	item, _ := m.Get(f.Name)
+	for _, name := range f.FormerNames {
+		former, ok := m.Get(name)
+		if !ok {
+			continue
+		}
+		if item != nil {
+			return nil, fmt.Errorf("field is set as both %v and %v", item.Name, former.Name)
+		}
+		item = former
+	}
+	return item, nil
+}
+
+// structFieldNames returns the current and former names of the fields of t.
+func structFieldNames(t schema.Struct) map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, f := range t.Fields {
+		names[f.Name] = struct{}{}
+		for _, name := range f.FormerNames {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+func findStructField(t *schema.Struct, name string) *schema.StructField {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+// findStructFieldByAnyName finds the field of t with the given current or
+// former name.
+func findStructFieldByAnyName(t *schema.Struct, name string) *schema.StructField {
+	if f := findStructField(t, name); f != nil {
+		return f
+	}
+	for i := range t.Fields {
+		for _, former := range t.Fields[i].FormerNames {
+			if former == name {
+				return &t.Fields[i]
+			}
+		}
+	}
+	return nil
+}
+
+func setItemToPathElement(s *schema.Schema, list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
 	pe := fieldpath.PathElement{}
 	switch {
-	case child.Map != nil:
-		// TODO: atomic maps should be acceptable.
+	case child.Map != nil && !isAtomicElement(s, list.ElementType):
 		return pe, errors.New("associative list without keys has an element that's a map type")
-	case child.List != nil:
-		// Should we support a set of lists? For the moment
-		// let's say we don't.
-		// TODO: atomic lists should be acceptable.
-		return pe, errors.New("not supported: associative list with lists as elements")
+	case child.List != nil && !isAtomicElement(s, list.ElementType):
+		return pe, errors.New("not supported: associative list with non-atomic lists as elements")
 	case child.Null:
 		return pe, errors.New("associative list without keys has an element that's an explicit null")
 	default:
-		// We are a set type.
+		// We are a set type. Atomic maps and lists are identified by
+		// their whole value, like scalars; scalars with a format by
+		// their canonical value.
+		if s != nil {
+			if _, a, ok := s.ResolveWithSchema(list.ElementType); ok {
+				if f := formatOf(a); f != nil {
+					child = f.canonical(child)
+				}
+			}
+		}
 		pe.Value = &child
 		return pe, nil
 	}
 }
 
-func listItemToPathElement(list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
+// isAtomicElement returns true if values of the given type are always
+// treated as a whole.
+func isAtomicElement(s *schema.Schema, tr schema.TypeRef) bool {
+	if s == nil {
+		return false
+	}
+	_, a, ok := s.ResolveWithSchema(tr)
+	if !ok {
+		return false
+	}
+	switch {
+	case a.Struct != nil:
+		return a.Struct.ElementRelationship == schema.Atomic
+	case a.List != nil:
+		return a.List.ElementRelationship == schema.Atomic
+	case a.Map != nil:
+		return a.Map.ElementRelationship == schema.Atomic
+	case a.Untyped != nil:
+		return a.Untyped.ElementRelationship == "" || a.Untyped.ElementRelationship == schema.Atomic
+	}
+	return false
+}
+
+func listItemToPathElement(s *schema.Schema, list schema.List, index int, child value.Value) (fieldpath.PathElement, error) {
 	if list.ElementRelationship == schema.Associative {
 		if len(list.Keys) > 0 {
-			return keyedAssociativeListItemToPathElement(list, index, child)
+			return keyedAssociativeListItemToPathElement(s, list, index, child)
 		}
 
-		// If there's no keys, then we must be a set of primitives.
-		return setItemToPathElement(list, index, child)
+		// If there's no keys, then we must be a set of primitives
+		// or atomic values.
+		return setItemToPathElement(s, list, index, child)
 	}
 
 	// Use the index as a key for atomic lists.
@@ -17,6 +17,8 @@ limitations under the License.
 package typed
 
 import (
+	"reflect"
+
 	"sigs.k8s.io/structured-merge-diff/fieldpath"
 	"sigs.k8s.io/structured-merge-diff/schema"
 	"sigs.k8s.io/structured-merge-diff/value"
@@ -24,10 +26,11 @@ import (
 
 type mergingWalker struct {
 	errorFormatter
-	lhs     *value.Value
-	rhs     *value.Value
-	schema  *schema.Schema
-	typeRef schema.TypeRef
+	lhs      *value.Value
+	rhs      *value.Value
+	schema   *schema.Schema
+	typeRef  schema.TypeRef
+	resolver TypeResolver
 
 	// How to merge. Called after schema validation for all leaf fields.
 	rule mergeRule
@@ -36,11 +39,18 @@ type mergingWalker struct {
 	// probably already set.)
 	postItemHook mergeRule
 
+	// If set, nulls in rhs remove values rather than set them to null.
+	deleteNulls bool
+
 	// output of the merge operation (nil if none)
 	out *value.Value
 
 	// internal housekeeping--don't set when constructing.
-	inLeaf bool // Set to true if we're in a "big leaf"--atomic map/list
+	inLeaf    bool           // Set to true if we're in a "big leaf"--atomic map/list
+	scalar    *schema.Scalar // Set to the declared type if we're at a scalar
+	immutable bool           // Set to true within immutable values that lhs has set
+	format    *Format        // Set to the format of the scalar, if it has one
+	deleting  bool           // Set to true within values that a null in rhs removes
 }
 
 // merge rules examine w.lhs and w.rhs (up to one of which may be nil) and
@@ -60,19 +70,103 @@ var (
 	})
 )
 
+// ruleCheckImmutable wraps rule, adding an error to errs for every immutable
+// leaf which rhs changes. If removals is set, a leaf missing from rhs counts
+// as changed, i.e. rhs is a complete object rather than a partial one.
+func ruleCheckImmutable(rule mergeRule, removals bool, errs *ValidationErrors) mergeRule {
+	return func(w *mergingWalker) {
+		if w.immutable {
+			changed := false
+			switch {
+			case w.rhs == nil:
+				changed = removals || w.deleting
+			case w.lhs == nil:
+				changed = true
+			default:
+				changed = !w.leafEqual()
+			}
+			if changed {
+				*errs = append(*errs, w.errorf("immutable field changed from %v to %v",
+					humanReadableOrUnset(w.lhs), humanReadableOrUnset(w.rhs))...)
+			}
+		}
+		rule(w)
+	}
+}
+
+// ruleTrackRHS wraps rule (which may be nil), adding to set the path of
+// every item that rhs has.
+func ruleTrackRHS(rule mergeRule, set *fieldpath.Set) mergeRule {
+	return func(w *mergingWalker) {
+		if w.rhs != nil {
+			set.Insert(w.path)
+		}
+		if rule != nil {
+			rule(w)
+		}
+	}
+}
+
+func humanReadableOrUnset(v *value.Value) string {
+	if v == nil {
+		return "<unset>"
+	}
+	return v.HumanReadable()
+}
+
+// setImmutable makes w and its descendants immutable if lhs has a value.
+func (w *mergingWalker) setImmutable(immutable bool) {
+	if immutable && w.lhs != nil && !w.lhs.Null {
+		w.immutable = true
+	}
+}
+
+// deleteIfNull handles a null in rhs when nulls remove values: the lhs value
+// is walked alone, as if rhs were missing, and dropped from the output.
+func (w *mergingWalker) deleteIfNull() {
+	if w.deleteNulls && isNull(w.rhs) {
+		w.rhs = nil
+		w.deleting = true
+	}
+}
+
+// keepEmpty reports whether a map or list whose items were all removed is
+// still output, empty: when nulls remove values, only a null for the map or
+// list itself removes it.
+func (w *mergingWalker) keepEmpty() bool {
+	return w.deleteNulls && !w.deleting
+}
+
 // merge sets w.out.
 func (w *mergingWalker) merge() ValidationErrors {
+	w.deleteIfNull()
+	if w.deleting && w.lhs == nil {
+		// There's nothing to remove.
+		return nil
+	}
 	if w.lhs == nil && w.rhs == nil {
 		// check this condidition here instead of everywhere below.
 		return w.errorf("at least one of lhs and rhs must be provided")
 	}
-	errs := resolveSchema(w.schema, w.typeRef, w)
+	errs := w.resolve()
 	if !w.inLeaf && w.postItemHook != nil {
 		w.postItemHook(w)
 	}
 	return errs
 }
 
+// resolve finds the atom for w.typeRef, switching w.schema if the type is
+// defined in another schema, and calls the matching do* method.
+func (w *mergingWalker) resolve() ValidationErrors {
+	s, a, errs := w.resolveSchema(w.schema, w.typeRef)
+	if len(errs) > 0 {
+		return errs
+	}
+	w.schema = s
+	w.format = formatOf(a)
+	return handleAtom(a, w)
+}
+
 // doLeaf should be called on leaves before descending into children, if there
 // will be a descent. It modifies w.inLeaf.
 func (w *mergingWalker) doLeaf() {
@@ -85,6 +179,9 @@ func (w *mergingWalker) doLeaf() {
 
 	// We don't recurse into leaf fields for merging.
 	w.rule(w)
+	if w.deleting {
+		w.out = nil
+	}
 }
 
 func (w *mergingWalker) doScalar(t schema.Scalar) (errs ValidationErrors) {
@@ -95,11 +192,24 @@ func (w *mergingWalker) doScalar(t schema.Scalar) (errs ValidationErrors) {
 	}
 
 	// All scalars are leaf fields.
+	w.scalar = &t
 	w.doLeaf()
 
 	return nil
 }
 
+// leafEqual returns true if lhs and rhs (which must both be set) are equal,
+// according to the declared type if it is known.
+func (w *mergingWalker) leafEqual() bool {
+	if w.format != nil {
+		return w.format.equal(*w.lhs, *w.rhs)
+	}
+	if w.scalar != nil {
+		return scalarEqual(*w.scalar, *w.lhs, *w.rhs)
+	}
+	return value.Equals(*w.lhs, *w.rhs)
+}
+
 func (w *mergingWalker) prepareDescent(pe fieldpath.PathElement, tr schema.TypeRef) *mergingWalker {
 	w2 := *w
 	w2.typeRef = tr
@@ -107,34 +217,49 @@ func (w *mergingWalker) prepareDescent(pe fieldpath.PathElement, tr schema.TypeR
 	w2.lhs = nil
 	w2.rhs = nil
 	w2.out = nil
+	w2.scalar = nil
+	w2.format = nil
 	return &w2
 }
 
 func (w *mergingWalker) visitStructFields(t schema.Struct, lhs, rhs *value.Map) (errs ValidationErrors) {
 	out := &value.Map{}
 
-	valOrNil := func(m *value.Map, name string) *value.Value {
-		if m == nil {
+	valOrNil := func(w2 *mergingWalker, prefix string, m *value.Map, f schema.StructField) *value.Value {
+		item, err := structFieldItem(m, f)
+		if err != nil {
+			errs = append(errs, w2.prefixError(prefix, err)...)
 			return nil
 		}
-		val, ok := m.Get(name)
-		if ok {
-			return &val.Value
+		if item != nil {
+			return &item.Value
 		}
 		return nil
 	}
 
-	allowedNames := map[string]struct{}{}
+	allowedNames := structFieldNames(t)
 	for i := range t.Fields {
 		// I don't want to use the loop variable since a reference
 		// might outlive the loop iteration (in an error message).
 		f := t.Fields[i]
-		allowedNames[f.Name] = struct{}{}
+		// Fields found under a former name are merged, and output,
+		// under the current one.
 		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &f.Name}, f.Type)
-		w2.lhs = valOrNil(lhs, f.Name)
-		w2.rhs = valOrNil(rhs, f.Name)
+		w2.lhs = valOrNil(w2, "lhs: ", lhs, f)
+		w2.rhs = valOrNil(w2, "rhs: ", rhs, f)
+		w2.setImmutable(f.Immutable)
+		w2.deleteIfNull()
 		if w2.lhs == nil && w2.rhs == nil {
-			// All fields are optional
+			// Fields are allowed to be missing here, even if
+			// they're required.
+			continue
+		}
+		if f.Nullable != nil && *f.Nullable && (isNull(w2.lhs) || isNull(w2.rhs)) {
+			// An explicit null is a leaf, whatever the type.
+			w2.doLeaf()
+			if w2.out != nil {
+				out.Set(f.Name, *w2.out)
+			}
 			continue
 		}
 		if newErrs := w2.merge(); len(newErrs) > 0 {
@@ -144,20 +269,73 @@ func (w *mergingWalker) visitStructFields(t schema.Struct, lhs, rhs *value.Map)
 		}
 	}
 
-	// All fields may be optional, but unknown fields are not allowed.
-	errs = append(errs, w.rejectExtraStructFields(lhs, allowedNames, "lhs: ")...)
-	errs = append(errs, w.rejectExtraStructFields(rhs, allowedNames, "rhs: ")...)
+	if t.PreserveUnknownFields {
+		errs = append(errs, w.visitUnknownStructFields(lhs, rhs, allowedNames, out)...)
+	} else {
+		// Unknown fields are not allowed.
+		errs = append(errs, w.rejectExtraStructFields(lhs, allowedNames, "lhs: ")...)
+		errs = append(errs, w.rejectExtraStructFields(rhs, allowedNames, "rhs: ")...)
+	}
 	if len(errs) > 0 {
 		return errs
 	}
 
-	if len(out.Items) > 0 {
+	if len(out.Items) > 0 || w.keepEmpty() {
 		w.out = &value.Value{Map: out}
 	}
 
 	return errs
 }
 
+// visitUnknownStructFields merges the fields of lhs and rhs which aren't in
+// allowedNames as atomic untyped values, adding them to out.
+func (w *mergingWalker) visitUnknownStructFields(lhs, rhs *value.Map, allowedNames map[string]struct{}, out *value.Map) (errs ValidationErrors) {
+	visit := func(name string, lval, rval *value.Value) {
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &name}, atomicUntyped)
+		w2.lhs = lval
+		w2.rhs = rval
+		if newErrs := w2.merge(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+		} else if w2.out != nil {
+			out.Set(name, *w2.out)
+		}
+	}
+	if lhs != nil {
+		for i := range lhs.Items {
+			litem := &lhs.Items[i]
+			if _, known := allowedNames[litem.Name]; known {
+				continue
+			}
+			var rval *value.Value
+			if rhs != nil {
+				if ritem, ok := rhs.Get(litem.Name); ok {
+					rval = &ritem.Value
+				}
+			}
+			visit(litem.Name, &litem.Value, rval)
+		}
+	}
+	if rhs != nil {
+		for i := range rhs.Items {
+			ritem := &rhs.Items[i]
+			if _, known := allowedNames[ritem.Name]; known {
+				continue
+			}
+			if lhs != nil {
+				if _, ok := lhs.Get(ritem.Name); ok {
+					continue
+				}
+			}
+			visit(ritem.Name, nil, &ritem.Value)
+		}
+	}
+	return errs
+}
+
+func isNull(v *value.Value) bool {
+	return v != nil && v.Null
+}
+
 func (w *mergingWalker) derefMapOrStruct(prefix, typeName string, v *value.Value, dest **value.Map) (errs ValidationErrors) {
 	// taking dest as input so that it can be called as a one-liner with
 	// append.
@@ -186,6 +364,7 @@ func (w *mergingWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
 	emptyPromoteToLeaf := (lhs == nil || len(lhs.Items) == 0) &&
 		(rhs == nil || len(rhs.Items) == 0)
 
+	w.setImmutable(t.Immutable)
 	if t.ElementRelationship == schema.Atomic || emptyPromoteToLeaf {
 		w.doLeaf()
 		return nil
@@ -203,20 +382,30 @@ func (w *mergingWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
 	return errs
 }
 
+// listItem is an item of an associative list being merged, from either side
+// or both.
+type listItem struct {
+	pe       fieldpath.PathElement
+	lhs, rhs *value.Value
+	// followers are the items only found in the lhs which come after this
+	// one, up to the next item which is also in the rhs.
+	followers []*listItem
+}
+
 func (w *mergingWalker) visitListItems(t schema.List, lhs, rhs *value.List) (errs ValidationErrors) {
 	out := &value.List{}
 
-	// TODO: ordering is totally wrong.
-	// TODO: might as well make the map order work the same way.
-
-	// This is a cheap hack to at least make the output order stable.
-	rhsOrder := []fieldpath.PathElement{}
+	// The output follows the order of the rhs for the items it mentions.
+	// Items only found in the lhs keep their place after the closest lhs
+	// item which is also in the rhs (or at the start of the list, if there
+	// is none), so that they stay near their original neighbors.
 
 	// First, collect all RHS children.
-	observedRHS := map[string]value.Value{}
+	var rhsItems []*listItem
+	observedRHS := map[string]*listItem{}
 	if rhs != nil {
-		for i, child := range rhs.Items {
-			pe, err := listItemToPathElement(t, i, child)
+		for i := range rhs.Items {
+			pe, err := listItemToPathElement(w.schema, t, i, rhs.Items[i])
 			if err != nil {
 				errs = append(errs, w.errorf("rhs: element %v: %v", i, err.Error())...)
 				// If we can't construct the path element, we can't
@@ -227,17 +416,21 @@ func (w *mergingWalker) visitListItems(t schema.List, lhs, rhs *value.List) (err
 			keyStr := pe.String()
 			if _, found := observedRHS[keyStr]; found {
 				errs = append(errs, w.errorf("rhs: duplicate entries for key %v", keyStr)...)
+				continue
 			}
-			observedRHS[keyStr] = child
-			rhsOrder = append(rhsOrder, pe)
+			item := &listItem{pe: pe, rhs: &rhs.Items[i]}
+			observedRHS[keyStr] = item
+			rhsItems = append(rhsItems, item)
 		}
 	}
 
-	// Then merge with LHS children.
+	// Then match them with LHS children, placing the others.
+	var leading []*listItem
+	var anchor *listItem
 	observedLHS := map[string]struct{}{}
 	if lhs != nil {
-		for i, child := range lhs.Items {
-			pe, err := listItemToPathElement(t, i, child)
+		for i := range lhs.Items {
+			pe, err := listItemToPathElement(w.schema, t, i, lhs.Items[i])
 			if err != nil {
 				errs = append(errs, w.errorf("lhs: element %v: %v", i, err.Error())...)
 				// If we can't construct the path element, we can't
@@ -251,34 +444,41 @@ func (w *mergingWalker) visitListItems(t schema.List, lhs, rhs *value.List) (err
 				continue
 			}
 			observedLHS[keyStr] = struct{}{}
-			w2 := w.prepareDescent(pe, t.ElementType)
-			w2.lhs = &child
-			if rchild, ok := observedRHS[keyStr]; ok {
-				w2.rhs = &rchild
+			if item, ok := observedRHS[keyStr]; ok {
+				item.lhs = &lhs.Items[i]
+				anchor = item
+				continue
 			}
-			if newErrs := w2.merge(); len(newErrs) > 0 {
-				errs = append(errs, newErrs...)
-			} else if w2.out != nil {
-				out.Items = append(out.Items, *w2.out)
+			item := &listItem{pe: pe, lhs: &lhs.Items[i]}
+			if anchor == nil {
+				leading = append(leading, item)
+			} else {
+				anchor.followers = append(anchor.followers, item)
 			}
-			// Keep track of children that have been handled
-			delete(observedRHS, keyStr)
 		}
 	}
 
-	for _, rhsToCheck := range rhsOrder {
-		if unmergedChild, ok := observedRHS[rhsToCheck.String()]; ok {
-			w2 := w.prepareDescent(rhsToCheck, t.ElementType)
-			w2.rhs = &unmergedChild
-			if newErrs := w2.merge(); len(newErrs) > 0 {
-				errs = append(errs, newErrs...)
-			} else if w2.out != nil {
-				out.Items = append(out.Items, *w2.out)
-			}
+	mergeItem := func(item *listItem) {
+		w2 := w.prepareDescent(item.pe, t.ElementType)
+		w2.lhs = item.lhs
+		w2.rhs = item.rhs
+		if newErrs := w2.merge(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+		} else if w2.out != nil {
+			out.Items = append(out.Items, *w2.out)
+		}
+	}
+	for _, item := range leading {
+		mergeItem(item)
+	}
+	for _, item := range rhsItems {
+		mergeItem(item)
+		for _, follower := range item.followers {
+			mergeItem(follower)
 		}
 	}
 
-	if len(out.Items) > 0 {
+	if len(out.Items) > 0 || w.keepEmpty() {
 		w.out = &value.Value{List: out}
 	}
 	return errs
@@ -312,6 +512,7 @@ func (w *mergingWalker) doList(t schema.List) (errs ValidationErrors) {
 	emptyPromoteToLeaf := (lhs == nil || len(lhs.Items) == 0) &&
 		(rhs == nil || len(rhs.Items) == 0)
 
+	w.setImmutable(t.Immutable)
 	if t.ElementRelationship == schema.Atomic || emptyPromoteToLeaf {
 		w.doLeaf()
 		return nil
@@ -321,52 +522,146 @@ func (w *mergingWalker) doList(t schema.List) (errs ValidationErrors) {
 		return nil
 	}
 
+	if t.ElementRelationship == schema.Positional {
+		return w.visitPositionalListItems(t, lhs, rhs)
+	}
 	errs = w.visitListItems(t, lhs, rhs)
 
 	return errs
 }
 
-func (w *mergingWalker) visitMapItems(t schema.Map, lhs, rhs *value.Map) (errs ValidationErrors) {
-	out := &value.Map{}
-
+// visitPositionalListItems merges the items of lhs and rhs which have the
+// same index. Items past the end of the shorter list are merged alone, so the
+// output is as long as the longer list, less any trailing items removed by
+// nulls.
+func (w *mergingWalker) visitPositionalListItems(t schema.List, lhs, rhs *value.List) (errs ValidationErrors) {
+	var lhsItems, rhsItems []value.Value
 	if lhs != nil {
-		for _, litem := range lhs.Items {
-			name := litem.Name
-			w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &name}, t.ElementType)
-			w2.lhs = &litem.Value
-			if rhs != nil {
-				if ritem, ok := rhs.Get(litem.Name); ok {
-					w2.rhs = &ritem.Value
-				}
-			}
-			if newErrs := w2.merge(); len(newErrs) > 0 {
-				errs = append(errs, newErrs...)
-			} else if w2.out != nil {
-				out.Set(name, *w2.out)
-			}
+		lhsItems = lhs.Items
+	}
+	if rhs != nil {
+		rhsItems = rhs.Items
+	}
+	n := len(lhsItems)
+	if len(rhsItems) > n {
+		n = len(rhsItems)
+	}
+
+	outs := make([]*value.Value, n)
+	for i := 0; i < n; i++ {
+		i := i
+		w2 := w.prepareDescent(fieldpath.PathElement{Index: &i}, t.ElementType)
+		if i < len(lhsItems) {
+			w2.lhs = &lhsItems[i]
+		}
+		if i < len(rhsItems) {
+			w2.rhs = &rhsItems[i]
 		}
+		if newErrs := w2.merge(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		outs[i] = w2.out
+	}
+	if len(errs) > 0 {
+		return errs
 	}
 
-	if rhs != nil {
-		for _, ritem := range rhs.Items {
-			if lhs != nil {
-				if _, ok := lhs.Get(ritem.Name); ok {
-					continue
-				}
-			}
+	// Items are only removed by nulls (see DeleteNulls), which can
+	// truncate the list but can't remove an item before one which stays,
+	// since every item after it would change.
+	end := n
+	for end > 0 && outs[end-1] == nil {
+		end--
+	}
+	out := &value.List{}
+	for i := 0; i < end; i++ {
+		if outs[i] == nil {
+			i := i
+			w2 := w.prepareDescent(fieldpath.PathElement{Index: &i}, t.ElementType)
+			errs = append(errs, w2.errorf("null can only remove items at the end of a positional list")...)
+			continue
+		}
+		out.Items = append(out.Items, *outs[i])
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 
-			name := ritem.Name
-			w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &name}, t.ElementType)
+	if len(out.Items) > 0 || w.keepEmpty() {
+		w.out = &value.Value{List: out}
+	}
+	return nil
+}
+
+// indexMapItems returns the items of m by canonical key, and the canonical
+// keys in order.
+func (w *mergingWalker) indexMapItems(prefix string, t schema.Map, m *value.Map) (map[string]*value.Field, []string, ValidationErrors) {
+	if m == nil {
+		return nil, nil, nil
+	}
+	var errs ValidationErrors
+	byKey := map[string]*value.Field{}
+	keys := []string{}
+	for i := range m.Items {
+		key, err := canonicalMapKey(t, m.Items[i].Name)
+		if err != nil {
+			errs = append(errs, w.prefixError(prefix, err)...)
+			continue
+		}
+		if _, found := byKey[key]; found {
+			errs = append(errs, w.errorf("%vduplicate entries for key %q", prefix, key)...)
+			continue
+		}
+		byKey[key] = &m.Items[i]
+		keys = append(keys, key)
+	}
+	return byKey, keys, errs
+}
+
+func (w *mergingWalker) visitMapItems(t schema.Map, lhs, rhs *value.Map) (errs ValidationErrors) {
+	out := &value.Map{}
+
+	lhsByKey, lhsKeys, newErrs := w.indexMapItems("lhs: ", t, lhs)
+	errs = append(errs, newErrs...)
+	rhsByKey, rhsKeys, newErrs := w.indexMapItems("rhs: ", t, rhs)
+	errs = append(errs, newErrs...)
+
+	for _, key := range lhsKeys {
+		key := key
+		litem := lhsByKey[key]
+		// The output keeps the spelling of the key of the side that
+		// wins, i.e. the rhs if it has the key.
+		name := litem.Name
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &key}, t.ElementType)
+		w2.lhs = &litem.Value
+		if ritem, ok := rhsByKey[key]; ok {
 			w2.rhs = &ritem.Value
-			if newErrs := w2.merge(); len(newErrs) > 0 {
-				errs = append(errs, newErrs...)
-			} else if w2.out != nil {
-				out.Set(name, *w2.out)
-			}
+			name = ritem.Name
+		}
+		if newErrs := w2.merge(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+		} else if w2.out != nil {
+			out.Set(name, *w2.out)
+		}
+	}
+
+	for _, key := range rhsKeys {
+		if _, ok := lhsByKey[key]; ok {
+			continue
+		}
+		key := key
+		ritem := rhsByKey[key]
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &key}, t.ElementType)
+		w2.rhs = &ritem.Value
+		if newErrs := w2.merge(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+		} else if w2.out != nil {
+			out.Set(ritem.Name, *w2.out)
 		}
 	}
 
-	if len(out.Items) > 0 {
+	if len(out.Items) > 0 || w.keepEmpty() {
 		w.out = &value.Value{Map: out}
 	}
 	return errs
@@ -386,6 +681,7 @@ func (w *mergingWalker) doMap(t schema.Map) (errs ValidationErrors) {
 	emptyPromoteToLeaf := (lhs == nil || len(lhs.Items) == 0) &&
 		(rhs == nil || len(rhs.Items) == 0)
 
+	w.setImmutable(t.Immutable)
 	if t.ElementRelationship == schema.Atomic || emptyPromoteToLeaf {
 		w.doLeaf()
 		return nil
@@ -401,6 +697,12 @@ func (w *mergingWalker) doMap(t schema.Map) (errs ValidationErrors) {
 }
 
 func (w *mergingWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
+	if t.ElementRelationship == schema.Guess {
+		return handleAtom(guessUntypedType(w.lhs, w.rhs).Inlined, w)
+	}
+	if t.ElementRelationship == schema.Lookup {
+		return w.doLookup()
+	}
 	if t.ElementRelationship == "" || t.ElementRelationship == schema.Atomic {
 		// Untyped sections allow anything, and are considered leaf
 		// fields.
@@ -408,3 +710,42 @@ func (w *mergingWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
 	}
 	return nil
 }
+
+// doLookup finds the types of lhs and rhs with the resolver, and merges them
+// according to that type. If they're of different types, the rhs replaces
+// the lhs entirely.
+func (w *mergingWalker) doLookup() (errs ValidationErrors) {
+	var lhsSchema, rhsSchema *schema.Schema
+	var lhsType, rhsType schema.TypeRef
+	if w.lhs != nil && !w.lhs.Null {
+		var newErrs ValidationErrors
+		lhsSchema, lhsType, newErrs = w.lookupType(w.resolver, w.schema, *w.lhs)
+		errs = append(errs, prefixErrors("lhs: ", newErrs)...)
+	}
+	if w.rhs != nil && !w.rhs.Null {
+		var newErrs ValidationErrors
+		rhsSchema, rhsType, newErrs = w.lookupType(w.resolver, w.schema, *w.rhs)
+		errs = append(errs, prefixErrors("rhs: ", newErrs)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	switch {
+	case lhsSchema == nil && rhsSchema == nil:
+		// Only nulls.
+		w.doLeaf()
+		return nil
+	case lhsSchema == nil:
+		w.schema, w.typeRef = rhsSchema, rhsType
+	case rhsSchema == nil:
+		w.schema, w.typeRef = lhsSchema, lhsType
+	case lhsSchema == rhsSchema && reflect.DeepEqual(lhsType, rhsType):
+		w.schema, w.typeRef = lhsSchema, lhsType
+	default:
+		// The type changed; nothing to merge.
+		w.doLeaf()
+		return nil
+	}
+	return w.resolve()
+}
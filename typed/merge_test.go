@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"testing"
 
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
 	"sigs.k8s.io/structured-merge-diff/schema"
 	"sigs.k8s.io/structured-merge-diff/value"
 
@@ -327,6 +328,431 @@ var mergeCases = []mergeTestCase{{
 		`{"atomicList":["a","a"]}`,
 		`{"atomicList":["a","a"]}`,
 	}},
+}, {
+	name:         "guessed untyped",
+	rootTypeName: "plugin",
+	schema: `types:
+- name: plugin
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: config
+      type:
+        untyped:
+          elementRelationship: guess
+`,
+	triplets: []mergeTriplet{{
+		`{"config":{"a":1}}`,
+		`{"config":{"b":2}}`,
+		`{"config":{"a":1,"b":2}}`,
+	}, {
+		`{"config":{"a":{"b":1,"c":2}}}`,
+		`{"config":{"a":{"b":3}}}`,
+		`{"config":{"a":{"b":3,"c":2}}}`,
+	}, {
+		`{"config":{"args":["a","b"]}}`,
+		`{"config":{"args":["c"]}}`,
+		`{"config":{"args":["c"]}}`,
+	}, {
+		`{"config":{"a":{"b":1}}}`,
+		`{"config":{"a":"b"}}`,
+		`{"config":{"a":"b"}}`,
+	}, {
+		`{"config":{"containers":[{"name":"a","image":"x"},{"name":"b","image":"y"}]}}`,
+		`{"config":{"containers":[{"name":"b","image":"z"},{"name":"c"}]}}`,
+		`{"config":{"containers":[{"name":"a","image":"x"},{"name":"b","image":"z"},{"name":"c"}]}}`,
+	}, {
+		`{"config":{"containers":[{"name":"a","image":"x"}]}}`,
+		`{"config":{"containers":[{"image":"z"}]}}`,
+		`{"config":{"containers":[{"image":"z"}]}}`,
+	}},
+}, {
+	name:         "required and nullable",
+	rootTypeName: "myStruct",
+	schema: `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      required: true
+    - name: nullableString
+      type:
+        scalar: string
+      nullable: true
+    - name: nullableStruct
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+          - name: b
+            type:
+              scalar: string
+      nullable: true
+`,
+	triplets: []mergeTriplet{{
+		`{"name":"a"}`,
+		`{"nullableString":"b"}`,
+		`{"name":"a","nullableString":"b"}`,
+	}, {
+		`{"nullableString":"b"}`,
+		`{"nullableString":null}`,
+		`{"nullableString":null}`,
+	}, {
+		`{"nullableString":null}`,
+		`{"nullableString":"b"}`,
+		`{"nullableString":"b"}`,
+	}, {
+		`{"nullableStruct":{"a":"a"}}`,
+		`{"nullableStruct":{"b":"b"}}`,
+		`{"nullableStruct":{"a":"a","b":"b"}}`,
+	}, {
+		`{"nullableStruct":{"a":"a"}}`,
+		`{"nullableStruct":null}`,
+		`{"nullableStruct":null}`,
+	}},
+}, {
+	name:         "preserve unknown fields",
+	rootTypeName: "crd",
+	schema: `types:
+- name: crd
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: replicas
+            type:
+              scalar: integer
+          preserveUnknownFields: true
+`,
+	triplets: []mergeTriplet{{
+		`{"spec":{"replicas":1}}`,
+		`{"spec":{"other":"a"}}`,
+		`{"spec":{"replicas":1,"other":"a"}}`,
+	}, {
+		`{"spec":{"replicas":1,"other":{"p":1}}}`,
+		`{"spec":{"other":{"q":2}}}`,
+		`{"spec":{"replicas":1,"other":{"q":2}}}`,
+	}, {
+		`{"spec":{"other":[1,2],"more":"b"}}`,
+		`{"spec":{"other":[3]}}`,
+		`{"spec":{"other":[3],"more":"b"}}`,
+	}},
+}, {
+	name:         "nested and defaulted keys",
+	rootTypeName: "service",
+	schema: `types:
+- name: service
+  struct:
+    fields:
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: servicePort
+          elementRelationship: associative
+          keys:
+          - port.number
+          - protocol
+- name: servicePort
+  struct:
+    fields:
+    - name: port
+      type:
+        struct:
+          fields:
+          - name: number
+            type:
+              scalar: integer
+          - name: name
+            type:
+              scalar: string
+    - name: protocol
+      type:
+        scalar: string
+      default: TCP
+    - name: target
+      type:
+        scalar: integer
+`,
+	triplets: []mergeTriplet{{
+		`{"ports":[{"port":{"number":80},"target":8080}]}`,
+		`{"ports":[{"port":{"number":80},"protocol":"TCP","target":9090}]}`,
+		`{"ports":[{"port":{"number":80},"protocol":"TCP","target":9090}]}`,
+	}, {
+		`{"ports":[{"port":{"number":80},"target":8080}]}`,
+		`{"ports":[{"port":{"number":80,"name":"http"}}]}`,
+		`{"ports":[{"port":{"number":80,"name":"http"},"target":8080}]}`,
+	}, {
+		`{"ports":[{"port":{"number":80}}]}`,
+		`{"ports":[{"port":{"number":80},"protocol":"UDP"}]}`,
+		`{"ports":[{"port":{"number":80}},{"port":{"number":80},"protocol":"UDP"}]}`,
+	}},
+}, {
+	name:         "sets of atomic values",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: selectors
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: ranges
+      type:
+        list:
+          elementType:
+            list:
+              elementType:
+                scalar: integer
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: granular
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+          elementRelationship: associative
+`,
+	triplets: []mergeTriplet{{
+		`{"selectors":[{"a":"b"}]}`,
+		`{"selectors":[{"a":"c"}]}`,
+		`{"selectors":[{"a":"b"},{"a":"c"}]}`,
+	}, {
+		`{"selectors":[{"a":"b","c":"d"}]}`,
+		`{"selectors":[{"c":"d","a":"b"}]}`,
+		`{"selectors":[{"c":"d","a":"b"}]}`,
+	}, {
+		`{"ranges":[[1,2]]}`,
+		`{"ranges":[[2,1],[1,2]]}`,
+		`{"ranges":[[2,1],[1,2]]}`,
+	}},
+}, {
+	name:         "map key types",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: ints
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: integer
+    - name: bools
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: boolean
+    - name: floats
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: float
+`,
+	triplets: []mergeTriplet{{
+		`{"ints":{"1":"a","2":"b"}}`,
+		`{"ints":{"01":"c"}}`,
+		`{"ints":{"01":"c","2":"b"}}`,
+	}, {
+		`{"ints":{"01":"a"}}`,
+		`{"ints":{"3":"c"}}`,
+		`{"ints":{"01":"a","3":"c"}}`,
+	}, {
+		`{"bools":{"true":"a"}}`,
+		`{"bools":{"True":"b","false":"c"}}`,
+		`{"bools":{"True":"b","false":"c"}}`,
+	}},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      formerNames:
+      - containerPort
+    - name: protocol
+      type:
+        scalar: string
+`,
+	triplets: []mergeTriplet{{
+		`{"count":1}`,
+		`{"replicas":2}`,
+		`{"replicas":2}`,
+	}, {
+		`{"count":1}`,
+		`{"ports":[{"port":80}]}`,
+		`{"replicas":1,"ports":[{"port":80}]}`,
+	}, {
+		`{"ports":[{"containerPort":80,"protocol":"TCP"}]}`,
+		`{"ports":[{"port":80,"protocol":"UDP"},{"containerPort":53}]}`,
+		`{"ports":[{"port":80,"protocol":"UDP"},{"port":53}]}`,
+	}},
+}, {
+	name:         "scalar unions",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer|string
+    - name: ports
+      type:
+        list:
+          elementType:
+            scalar: integer|string
+          elementRelationship: associative
+`,
+	triplets: []mergeTriplet{{
+		`{"port":80}`,
+		`{"port":"http"}`,
+		`{"port":"http"}`,
+	}, {
+		`{"ports":[80,"http"]}`,
+		`{"ports":["80",443]}`,
+		`{"ports":[80,"http","80",443]}`,
+	}},
+}, {
+	name:         "list ordering",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: items
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+    - name: name
+      type:
+        scalar: string
+`,
+	triplets: []mergeTriplet{{
+		`{"items":["a","b","c","d"]}`,
+		`{"items":["a","b","e","c"]}`,
+		`{"items":["a","b","e","c","d"]}`,
+	}, {
+		`{"items":["a","b","c"]}`,
+		`{"items":["c","a"]}`,
+		`{"items":["c","a","b"]}`,
+	}, {
+		`{"items":["x","a","y","b","z"]}`,
+		`{"items":["b","n","a"]}`,
+		`{"items":["x","b","z","n","a","y"]}`,
+	}, {
+		`{"items":["a","b"]}`,
+		`{"items":["c"]}`,
+		`{"items":["a","b","c"]}`,
+	}, {
+		`{"ports":[{"port":80,"name":"http"},{"port":443}]}`,
+		`{"ports":[{"port":53},{"port":80,"name":"web"}]}`,
+		`{"ports":[{"port":53},{"port":80,"name":"web"},{"port":443}]}`,
+	}},
+}, {
+	name:         "positional lists",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: steps
+      type:
+        list:
+          elementType:
+            namedType: step
+          elementRelationship: positional
+- name: step
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+`,
+	triplets: []mergeTriplet{{
+		`{"args":["a","b"]}`,
+		`{"args":["a","b","c"]}`,
+		`{"args":["a","b","c"]}`,
+	}, {
+		`{"args":["a","b","c"]}`,
+		`{"args":["x"]}`,
+		`{"args":["x","b","c"]}`,
+	}, {
+		`{"steps":[{"name":"a"},{"name":"b"}]}`,
+		`{"steps":[{"image":"x"},{"name":"c","image":"y"},{"name":"d"}]}`,
+		`{"steps":[{"name":"a","image":"x"},{"name":"c","image":"y"},{"name":"d"}]}`,
+	}, {
+		`{"steps":[{},{"name":"b"}]}`,
+		`{"steps":[{},{"image":"y"}]}`,
+		`{"steps":[{},{"name":"b","image":"y"}]}`,
+	}},
 }}
 
 func (tt mergeTestCase) test(t *testing.T) {
@@ -387,3 +813,274 @@ func TestMerge(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeImmutable(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      immutable: true
+    - name: replicas
+      type:
+        scalar: numeric
+      nullable: true
+      immutable: true
+    - name: selector
+      type:
+        map:
+          elementType:
+            scalar: string
+      immutable: true
+    - name: args
+      type:
+        namedType: args
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+- name: args
+  list:
+    elementType:
+      scalar: string
+    elementRelationship: atomic
+    immutable: true
+`)
+	cases := []struct {
+		lhs, rhs string
+		// errors are the expected error messages, in order; none for
+		// allowed changes.
+		errors []string
+		// compareErrors are the expected error messages of Compare, if
+		// they differ.
+		compareErrors []string
+	}{{
+		lhs: `{"name":"a","replicas":1,"labels":{"a":"b"}}`,
+		rhs: `{"name":"a","replicas":1.0,"labels":{"a":"c"}}`,
+	}, {
+		lhs: `{"labels":{"a":"b"},"replicas":null}`,
+		rhs: `{"name":"a","replicas":2,"selector":{"a":"b"},"args":["x"]}`,
+	}, {
+		lhs:    `{"name":"a","replicas":1}`,
+		rhs:    `{"name":"b","replicas":2}`,
+		errors: []string{`.name: immutable field changed from "a" to "b"`, `.replicas: immutable field changed from 1 to 2`},
+	}, {
+		lhs:    `{"selector":{"a":"b"},"args":["x"]}`,
+		rhs:    `{"selector":{"a":"b","c":"d"},"args":["y"]}`,
+		errors: []string{`.selector.c: immutable field changed from <unset> to "d"`, `.args: immutable field changed from ["x"] to ["y"]`},
+	}, {
+		lhs:           `{"name":"a","selector":{"a":"b"}}`,
+		rhs:           `{"selector":{}}`,
+		compareErrors: []string{`.name: immutable field changed from "a" to <unset>`, `.selector.a: immutable field changed from "b" to <unset>`},
+	}}
+
+	for i, tt := range cases {
+		lhs := AsTypedUnvalidated(mustValue(t, tt.lhs), s, "root")
+		rhs := AsTypedUnvalidated(mustValue(t, tt.rhs), s, "root")
+
+		// Without the option, anything goes.
+		if _, err := lhs.Merge(rhs); err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+		}
+		if _, err := lhs.Compare(rhs); err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+		}
+
+		_, err := lhs.Merge(rhs, EnforceImmutability())
+		checkErrors(t, fmt.Sprintf("%v: merge", i), tt.errors, err)
+		_, err = lhs.Compare(rhs, EnforceImmutability())
+		expect := tt.compareErrors
+		if expect == nil {
+			expect = tt.errors
+		}
+		checkErrors(t, fmt.Sprintf("%v: compare", i), expect, err)
+	}
+}
+
+func TestMergeDeleteNulls(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      immutable: true
+    - name: replicas
+      type:
+        scalar: integer
+      nullable: true
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+          - name: b
+            type:
+              scalar: string
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: containers
+      type:
+        list:
+          elementType:
+            namedType: container
+          elementRelationship: associative
+          keys:
+          - name
+    - name: command
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+- name: container
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+`)
+	cases := []struct {
+		lhs, rhs string
+		// merged is the expected result of Merge, and removed the
+		// paths reported as removed by Compare.
+		merged  string
+		removed *fieldpath.Set
+	}{{
+		lhs:     `{"name":"a","replicas":1}`,
+		rhs:     `{"replicas":null}`,
+		merged:  `{"name":"a"}`,
+		removed: _NS(_P("name"), _P("replicas")),
+	}, {
+		lhs:     `{"name":"a"}`,
+		rhs:     `{"replicas":null,"labels":null}`,
+		merged:  `{"name":"a"}`,
+		removed: _NS(_P("name")),
+	}, {
+		lhs:     `{"replicas":1,"spec":{"a":"x","b":"y"}}`,
+		rhs:     `{"spec":{"a":null}}`,
+		merged:  `{"replicas":1,"spec":{"b":"y"}}`,
+		removed: _NS(_P("replicas"), _P("spec", "a"), _P("spec", "b")),
+	}, {
+		lhs:     `{"replicas":1,"spec":{"a":"x","b":"y"},"labels":{"a":"b"}}`,
+		rhs:     `{"spec":null,"labels":null}`,
+		merged:  `{"replicas":1}`,
+		removed: _NS(_P("replicas"), _P("spec"), _P("spec", "a"), _P("spec", "b"), _P("labels"), _P("labels", "a")),
+	}, {
+		lhs:     `{"labels":{"a":"1","b":"2"}}`,
+		rhs:     `{"labels":{"a":null,"c":"3"}}`,
+		merged:  `{"labels":{"b":"2","c":"3"}}`,
+		removed: _NS(_P("labels", "a"), _P("labels", "b")),
+	}, {
+		lhs:    `{"containers":[{"name":"a","image":"x","args":["-v"]},{"name":"b","image":"y"}]}`,
+		rhs:    `{"containers":[{"name":"a","image":null,"args":null}]}`,
+		merged: `{"containers":[{"name":"a"},{"name":"b","image":"y"}]}`,
+		removed: _NS(
+			_P("containers", _KBF("name", _SV("a")), "image"),
+			_P("containers", _KBF("name", _SV("a")), "args"),
+			_P("containers", _KBF("name", _SV("b"))),
+			_P("containers", _KBF("name", _SV("b")), "name"),
+			_P("containers", _KBF("name", _SV("b")), "image"),
+		),
+	}, {
+		lhs:     `{"spec":{"a":"x"},"labels":{"a":"1"}}`,
+		rhs:     `{"spec":{"a":null},"labels":{"a":null}}`,
+		merged:  `{"spec":{},"labels":{}}`,
+		removed: _NS(_P("spec", "a"), _P("labels", "a")),
+	}, {
+		lhs:     `{"replicas":1}`,
+		rhs:     `{"replicas":null}`,
+		merged:  `{}`,
+		removed: _NS(_P("replicas")),
+	}, {
+		lhs:     `{"command":["a","b","c"]}`,
+		rhs:     `{"command":["x",null,null]}`,
+		merged:  `{"command":["x"]}`,
+		removed: _NS(_P("command", 1), _P("command", 2)),
+	}, {
+		lhs:     `{"command":["a"]}`,
+		rhs:     `{"command":[null,null]}`,
+		merged:  `{"command":[]}`,
+		removed: _NS(_P("command", 0)),
+	}}
+
+	for i, tt := range cases {
+		lhs := AsTypedUnvalidated(mustValue(t, tt.lhs), s, "root")
+		rhs := AsTypedUnvalidated(mustValue(t, tt.rhs), s, "root")
+
+		got, err := lhs.Merge(rhs, DeleteNulls())
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+			continue
+		}
+		if expect := mustValue(t, tt.merged); got.AsValue().HumanReadable() != expect.HumanReadable() {
+			t.Errorf("%v: expected\n%v\ngot\n%v", i, expect.HumanReadable(), got.AsValue().HumanReadable())
+		}
+
+		c, err := lhs.Compare(rhs, DeleteNulls())
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+			continue
+		}
+		if !c.Removed.Equals(tt.removed) {
+			t.Errorf("%v: expected removed\n%v\ngot\n%v", i, tt.removed, c.Removed)
+		}
+	}
+
+	// Without the option, nulls are kept.
+	lhs := AsTypedUnvalidated(mustValue(t, `{"name":"a","replicas":1}`), s, "root")
+	rhs := AsTypedUnvalidated(mustValue(t, `{"replicas":null}`), s, "root")
+	got, err := lhs.Merge(rhs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expect := `{name="a";replicas=null}`; got.AsValue().HumanReadable() != expect {
+		t.Errorf("expected\n%v\ngot\n%v", expect, got.AsValue().HumanReadable())
+	}
+
+	// Removing an immutable field changes it.
+	rhs = AsTypedUnvalidated(mustValue(t, `{"name":null}`), s, "root")
+	_, err = lhs.Merge(rhs, DeleteNulls(), EnforceImmutability())
+	checkErrors(t, "immutable", []string{`.name: immutable field changed from "a" to <unset>`}, err)
+
+	// Only the end of a positional list can be removed.
+	lhs = AsTypedUnvalidated(mustValue(t, `{"command":["a","b"]}`), s, "root")
+	rhs = AsTypedUnvalidated(mustValue(t, `{"command":[null,"c"]}`), s, "root")
+	_, err = lhs.Merge(rhs, DeleteNulls())
+	checkErrors(t, "positional", []string{`.command[0]: null can only remove items at the end of a positional list`}, err)
+}
+
+func checkErrors(t *testing.T, name string, expect []string, err error) {
+	t.Helper()
+	var got []string
+	if err != nil {
+		errs, ok := err.(ValidationErrors)
+		if !ok {
+			t.Fatalf("%v: expected validation errors, got %v", name, err)
+		}
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("%v: expected errors %q, got %q", name, expect, got)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"sort"
+
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+// ListOrder is how Normalize orders the items of associative lists. Atomic
+// lists always keep their order, since it's part of their value.
+type ListOrder int
+
+const (
+	// PreserveListOrder keeps the items of associative lists in the order
+	// they're in.
+	PreserveListOrder ListOrder = iota
+	// SortListsByKey sorts the items of associative lists by their keys,
+	// or by their values for lists without keys. Numbers are sorted
+	// numerically, before strings, which are sorted lexically.
+	SortListsByKey
+)
+
+type normalizingWalker struct {
+	errorFormatter
+	value    value.Value
+	schema   *schema.Schema
+	typeRef  schema.TypeRef
+	resolver TypeResolver
+
+	listOrder ListOrder
+
+	// output of the normalization
+	out value.Value
+}
+
+func (w *normalizingWalker) normalize() ValidationErrors {
+	w.out = w.value
+	s, a, errs := w.resolveSchema(w.schema, w.typeRef)
+	if len(errs) > 0 {
+		return errs
+	}
+	w.schema = s
+	return handleAtom(a, w)
+}
+
+func (w *normalizingWalker) prepareDescent(pe fieldpath.PathElement, tr schema.TypeRef, v value.Value) *normalizingWalker {
+	w2 := *w
+	w2.errorFormatter.descend(pe)
+	w2.typeRef = tr
+	w2.value = v
+	return &w2
+}
+
+func (w *normalizingWalker) doScalar(t schema.Scalar) ValidationErrors { return nil }
+
+func (w *normalizingWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "struct")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	// Known fields come first, in the order of the schema; fields found
+	// under a former name keep it. Unknown fields follow, sorted by name.
+	out := &value.Map{}
+	for i := range t.Fields {
+		f := t.Fields[i]
+		item, err := structFieldItem(m, f)
+		if err != nil {
+			errs = append(errs, w.error(err)...)
+			continue
+		}
+		if item == nil {
+			continue
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &f.Name}, f.Type, item.Value)
+		if newErrs := w2.normalize(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Items = append(out.Items, value.Field{Name: item.Name, Value: w2.out})
+	}
+
+	allowedNames := structFieldNames(t)
+	unknown := &value.Map{}
+	for _, item := range m.Items {
+		if _, known := allowedNames[item.Name]; !known {
+			// Unknown fields are atomic untyped data.
+			unknown.Items = append(unknown.Items, value.Field{Name: item.Name, Value: sortUntypedMaps(item.Value)})
+		}
+	}
+	sortMapItems(unknown)
+	out.Items = append(out.Items, unknown.Items...)
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *normalizingWalker) doList(t schema.List) (errs ValidationErrors) {
+	list, err := listValue(w.value)
+	if err != nil {
+		return w.error(err)
+	}
+	if list == nil {
+		return nil
+	}
+
+	type item struct {
+		pe fieldpath.PathElement
+		v  value.Value
+	}
+	var items []item
+	for i, child := range list.Items {
+		pe, err := listItemToPathElement(w.schema, t, i, child)
+		if err != nil {
+			errs = append(errs, w.errorf("element %v: %v", i, err.Error())...)
+			continue
+		}
+		w2 := w.prepareDescent(pe, t.ElementType, child)
+		if newErrs := w2.normalize(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		items = append(items, item{pe, w2.out})
+	}
+	if t.ElementRelationship == schema.Associative && w.listOrder == SortListsByKey {
+		sort.SliceStable(items, func(i, j int) bool {
+			return pathElementLess(items[i].pe, items[j].pe)
+		})
+	}
+
+	out := &value.List{}
+	for _, item := range items {
+		out.Items = append(out.Items, item.v)
+	}
+	w.out = value.Value{List: out}
+	return errs
+}
+
+func (w *normalizingWalker) doMap(t schema.Map) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "map")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	out := &value.Map{}
+	for _, item := range m.Items {
+		key, err := canonicalMapKey(t, item.Name)
+		if err != nil {
+			errs = append(errs, w.error(err)...)
+			continue
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &key}, t.ElementType, item.Value)
+		if newErrs := w2.normalize(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Items = append(out.Items, value.Field{Name: item.Name, Value: w2.out})
+	}
+	sortMapItems(out)
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *normalizingWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
+	switch {
+	case w.value.Null:
+		return nil
+	case t.ElementRelationship == schema.Lookup:
+		w.schema, w.typeRef, errs = w.lookupType(w.resolver, w.schema, w.value)
+		if len(errs) > 0 {
+			return errs
+		}
+		return w.normalize()
+	case t.ElementRelationship == schema.Guess:
+		w.typeRef = guessUntypedType(&w.value)
+		return w.normalize()
+	}
+	// Atomic untyped data has no schema to order its fields by, so they
+	// are sorted by name, at every level; lists keep their order.
+	w.out = sortUntypedMaps(w.value)
+	return nil
+}
+
+func sortUntypedMaps(v value.Value) value.Value {
+	switch {
+	case v.Map != nil:
+		out := &value.Map{}
+		for _, item := range v.Map.Items {
+			out.Items = append(out.Items, value.Field{Name: item.Name, Value: sortUntypedMaps(item.Value)})
+		}
+		sortMapItems(out)
+		return value.Value{Map: out}
+	case v.List != nil:
+		out := &value.List{}
+		for _, item := range v.List.Items {
+			out.Items = append(out.Items, sortUntypedMaps(item))
+		}
+		return value.Value{List: out}
+	}
+	return v
+}
+
+func sortMapItems(m *value.Map) {
+	sort.SliceStable(m.Items, func(i, j int) bool {
+		return m.Items[i].Name < m.Items[j].Name
+	})
+}
+
+// pathElementLess orders the path elements of the items of an associative
+// list: by each key in turn, or by value.
+func pathElementLess(lhs, rhs fieldpath.PathElement) bool {
+	if lhs.Value != nil && rhs.Value != nil {
+		return valueLess(*lhs.Value, *rhs.Value)
+	}
+	for i := range lhs.Key {
+		if i >= len(rhs.Key) {
+			return false
+		}
+		l, r := lhs.Key[i].Value, rhs.Key[i].Value
+		if valueLess(l, r) {
+			return true
+		}
+		if valueLess(r, l) {
+			return false
+		}
+	}
+	return len(lhs.Key) < len(rhs.Key)
+}
+
+// valueLess orders numbers numerically, then strings lexically, then any
+// other values by their canonical representation.
+func valueLess(lhs, rhs value.Value) bool {
+	l, lok := numericValue(lhs)
+	r, rok := numericValue(rhs)
+	switch {
+	case lok && rok:
+		return l < r
+	case lok != rok:
+		return lok
+	case lhs.String != nil && rhs.String != nil:
+		return *lhs.String < *rhs.String
+	case (lhs.String != nil) != (rhs.String != nil):
+		return lhs.String != nil
+	}
+	return lhs.Canonical() < rhs.Canonical()
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"testing"
+)
+
+var normalizeSchema = `types:
+- name: deployment
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: containers
+      type:
+        list:
+          elementType:
+            namedType: container
+          elementRelationship: associative
+          keys:
+          - name
+    - name: ports
+      type:
+        list:
+          elementType:
+            scalar: integer|string
+          elementRelationship: associative
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+    - name: labels
+      type:
+        map:
+          elementType:
+            scalar: string
+    - name: extra
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+          preserveUnknownFields: true
+    - name: config
+      type:
+        untyped: {}
+- name: container
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+`
+
+func TestNormalize(t *testing.T) {
+	s := mustSchema(t, normalizeSchema)
+	cases := []struct {
+		name      string
+		object    string
+		listOrder ListOrder
+		expect    string
+	}{{
+		name:   "struct fields",
+		object: `{"labels":{"b":"1","a":"2"},"count":3,"name":"a"}`,
+		expect: `{name="a";count=3;labels={a="2";b="1"}}`,
+	}, {
+		name:   "preserved lists",
+		object: `{"args":["b","a"],"ports":["http",443,80],"containers":[{"image":"b","name":"b"},{"name":"a"}]}`,
+		expect: `{containers=[{name="b";image="b"},{name="a"}];ports=["http",443,80];args=["b","a"]}`,
+	}, {
+		name:      "sorted lists",
+		object:    `{"args":["b","a"],"ports":["http",443,80],"containers":[{"image":"b","name":"b"},{"name":"a"}]}`,
+		listOrder: SortListsByKey,
+		expect:    `{containers=[{name="a"},{name="b";image="b"}];ports=[80,443,"http"];args=["b","a"]}`,
+	}, {
+		name:   "unknown fields",
+		object: `{"extra":{"z":1,"a":"x","b":{"d":1,"c":[{"f":1,"e":2}]}}}`,
+		expect: `{extra={a="x";b={c=[{e=2;f=1}];d=1};z=1}}`,
+	}, {
+		name:   "untyped",
+		object: `{"config":{"b":[3,1],"a":null}}`,
+		expect: `{config={a=null;b=[3,1]}}`,
+	}}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := AsTypedUnvalidated(mustValue(t, tt.object), s, "deployment")
+			got, err := obj.Normalize(tt.listOrder)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.value.HumanReadable() != tt.expect {
+				t.Errorf("expected\n%v\ngot\n%v", tt.expect, got.value.HumanReadable())
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("normalized object is invalid: %v", err)
+			}
+		})
+	}
+
+	obj := AsTypedUnvalidated(mustValue(t, `{"labels":[]}`), s, "deployment")
+	if _, err := obj.Normalize(PreserveListOrder); err == nil {
+		t.Errorf("expected an error for a list where a map is expected")
+	}
+}
+
+func TestMergeNormalizeOutput(t *testing.T) {
+	s := mustSchema(t, normalizeSchema)
+	lhs := AsTypedUnvalidated(mustValue(t, `{"labels":{"b":"1"},"containers":[{"name":"b"}],"name":"a"}`), s, "deployment")
+	rhs := AsTypedUnvalidated(mustValue(t, `{"replicas":1,"labels":{"a":"2"},"containers":[{"name":"a"}]}`), s, "deployment")
+	expect := `{name="a";replicas=1;containers=[{name="a"},{name="b"}];labels={a="2";b="1"}}`
+
+	merged, err := lhs.Merge(rhs, NormalizeOutput(SortListsByKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if merged.value.HumanReadable() != expect {
+		t.Errorf("expected\n%v\ngot\n%v", expect, merged.value.HumanReadable())
+	}
+
+	c, err := lhs.Compare(rhs, NormalizeOutput(SortListsByKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Merged.value.HumanReadable() != expect {
+		t.Errorf("expected\n%v\ngot\n%v", expect, c.Merged.value.HumanReadable())
+	}
+}
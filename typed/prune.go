@@ -0,0 +1,168 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+type pruningWalker struct {
+	errorFormatter
+	value    value.Value
+	schema   *schema.Schema
+	typeRef  schema.TypeRef
+	resolver TypeResolver
+
+	// Every path which is dropped is added here.
+	pruned *fieldpath.Set
+
+	// output of the pruning operation
+	out value.Value
+}
+
+func (w *pruningWalker) prune() ValidationErrors {
+	w.out = w.value
+	s, a, errs := w.resolveSchema(w.schema, w.typeRef)
+	if len(errs) > 0 {
+		return errs
+	}
+	w.schema = s
+	return handleAtom(a, w)
+}
+
+func (w *pruningWalker) prepareDescent(pe fieldpath.PathElement, tr schema.TypeRef, v value.Value) *pruningWalker {
+	w2 := *w
+	w2.errorFormatter.descend(pe)
+	w2.typeRef = tr
+	w2.value = v
+	return &w2
+}
+
+func (w *pruningWalker) doScalar(t schema.Scalar) ValidationErrors { return nil }
+
+func (w *pruningWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "struct")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	fields := map[string]schema.StructField{}
+	for _, f := range t.Fields {
+		fields[f.Name] = f
+		for _, name := range f.FormerNames {
+			fields[name] = f
+		}
+	}
+
+	out := &value.Map{}
+	for _, item := range m.Items {
+		name := item.Name
+		f, known := fields[name]
+		if known {
+			// Fields found under a former name keep it, but their
+			// paths use the current one.
+			name = f.Name
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &name}, f.Type, item.Value)
+		if !known {
+			if t.PreserveUnknownFields {
+				out.Set(item.Name, item.Value)
+			} else {
+				w.pruned.Insert(w2.path)
+			}
+			continue
+		}
+		if newErrs := w2.prune(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Set(item.Name, w2.out)
+	}
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *pruningWalker) doList(t schema.List) (errs ValidationErrors) {
+	list, err := listValue(w.value)
+	if err != nil {
+		return w.error(err)
+	}
+	if list == nil {
+		return nil
+	}
+
+	out := &value.List{}
+	for i, child := range list.Items {
+		pe, err := listItemToPathElement(w.schema, t, i, child)
+		if err != nil {
+			errs = append(errs, w.errorf("element %v: %v", i, err.Error())...)
+			continue
+		}
+		w2 := w.prepareDescent(pe, t.ElementType, child)
+		if newErrs := w2.prune(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Items = append(out.Items, w2.out)
+	}
+	w.out = value.Value{List: out}
+	return errs
+}
+
+func (w *pruningWalker) doMap(t schema.Map) (errs ValidationErrors) {
+	m, err := mapOrStructValue(w.value, "map")
+	if err != nil {
+		return w.error(err)
+	}
+	if m == nil {
+		return nil
+	}
+
+	out := &value.Map{}
+	for _, item := range m.Items {
+		key, err := canonicalMapKey(t, item.Name)
+		if err != nil {
+			errs = append(errs, w.error(err)...)
+			continue
+		}
+		w2 := w.prepareDescent(fieldpath.PathElement{FieldName: &key}, t.ElementType, item.Value)
+		if newErrs := w2.prune(); len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		out.Set(item.Name, w2.out)
+	}
+	w.out = value.Value{Map: out}
+	return errs
+}
+
+func (w *pruningWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
+	if t.ElementRelationship == schema.Lookup && !w.value.Null {
+		w.schema, w.typeRef, errs = w.lookupType(w.resolver, w.schema, w.value)
+		if len(errs) > 0 {
+			return errs
+		}
+		return w.prune()
+	}
+	// Untyped data has no unknown fields.
+	return nil
+}
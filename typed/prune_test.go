@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+
+	"gopkg.in/yaml.v2"
+)
+
+type pruneTestCase struct {
+	name         string
+	rootTypeName string
+	schema       string
+	triplets     []pruneTriplet
+}
+
+type pruneTriplet struct {
+	object string
+	pruned string
+	// removed is the set of paths reported as dropped.
+	removed *fieldpath.Set
+}
+
+var pruneCases = []pruneTestCase{{
+	name:         "unknown fields",
+	rootTypeName: "deployment",
+	schema: `types:
+- name: deployment
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: containers
+      type:
+        list:
+          elementType:
+            namedType: container
+          elementRelationship: associative
+          keys:
+          - name
+    - name: labels
+      type:
+        map:
+          elementType:
+            namedType: label
+    - name: extra
+      type:
+        struct:
+          fields:
+          - name: a
+            type:
+              scalar: string
+          preserveUnknownFields: true
+    - name: config
+      type:
+        untyped: {}
+- name: container
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+- name: label
+  struct:
+    fields:
+    - name: value
+      type:
+        scalar: string
+`,
+	triplets: []pruneTriplet{{
+		`{"name":"a","containers":[{"name":"c","image":"i"}]}`,
+		`{"name":"a","containers":[{"name":"c","image":"i"}]}`,
+		_NS(),
+	}, {
+		`{"name":"a","old":1,"older":{"b":2}}`,
+		`{"name":"a"}`,
+		_NS(_P("old"), _P("older")),
+	}, {
+		`{"containers":[{"name":"c","cpu":1},{"name":"d","image":"i"}]}`,
+		`{"containers":[{"name":"c"},{"name":"d","image":"i"}]}`,
+		_NS(_P("containers", _KBF("name", _SV("c")), "cpu")),
+	}, {
+		`{"labels":{"a":{"value":"b","color":"red"}}}`,
+		`{"labels":{"a":{"value":"b"}}}`,
+		_NS(_P("labels", "a", "color")),
+	}, {
+		`{"extra":{"a":"a","b":"b"},"config":{"anything":["goes"]}}`,
+		`{"extra":{"a":"a","b":"b"},"config":{"anything":["goes"]}}`,
+		_NS(),
+	}},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      formerNames:
+      - containerPort
+    - name: protocol
+      type:
+        scalar: string
+`,
+	triplets: []pruneTriplet{{
+		`{"count":1,"ports":[{"containerPort":80,"name":"http"}]}`,
+		`{"count":1,"ports":[{"containerPort":80}]}`,
+		_NS(_P("ports", _KBF("port", _IV(80)), "name")),
+	}},
+}}
+
+func (tt pruneTestCase) test(t *testing.T) {
+	var s schema.Schema
+	err := yaml.Unmarshal([]byte(tt.schema), &s)
+	if err != nil {
+		t.Fatalf("unable to unmarshal schema: %v", err)
+	}
+
+	for i, triplet := range tt.triplets {
+		triplet := triplet
+		t.Run(fmt.Sprintf("%v-%v", tt.name, i), func(t *testing.T) {
+			t.Parallel()
+			obj, err := value.FromYAML([]byte(triplet.object))
+			if err != nil {
+				t.Fatalf("unable to interpret yaml: %v\n%v", err, triplet.object)
+			}
+			expect, err := value.FromYAML([]byte(triplet.pruned))
+			if err != nil {
+				t.Fatalf("unable to interpret yaml: %v\n%v", err, triplet.pruned)
+			}
+
+			got, removed, err := AsTypedUnvalidated(obj, &s, tt.rootTypeName).Prune()
+			if err != nil {
+				t.Fatalf("got errors: %v", err)
+			}
+			if !reflect.DeepEqual(got.value.ToUnstructured(true), expect.ToUnstructured(true)) {
+				t.Errorf("Expected\n%v\nbut got\n%v\n",
+					expect.HumanReadable(), got.value.HumanReadable(),
+				)
+			}
+			if !removed.Equals(triplet.removed) {
+				t.Errorf("wanted removed\n%s\ngot\n%s\n", triplet.removed, removed)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("pruned object is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	for _, tt := range pruneCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.test(t)
+		})
+	}
+}
+
+func TestPruneErrors(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: list
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+`)
+	_, _, err := AsTypedUnvalidated(mustValue(t, `{"list":{"a":"b"}}`), s, "root").Prune()
+	if err == nil {
+		t.Errorf("expected an error pruning a map where a list is expected")
+	}
+}
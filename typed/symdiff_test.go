@@ -466,6 +466,284 @@ var symdiffCases = []symdiffTestCase{{
 		modified: _NS(_P("atomicList")),
 		added:    _NS(),
 	}},
+}, {
+	name:         "integer and float",
+	rootTypeName: "myStruct",
+	schema: `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: numeric
+      type:
+        scalar: numeric
+    - name: int
+      type:
+        scalar: integer
+    - name: float
+      type:
+        scalar: float
+    - name: untyped
+      type:
+        untyped: {}
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"numeric":1,"int":1,"float":1}`,
+		rhs:      `{"numeric":1.0,"int":1.0,"float":1.0}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"int":1,"float":1}`,
+		rhs:      `{"int":2,"float":1.5}`,
+		removed:  _NS(),
+		modified: _NS(_P("int"), _P("float")),
+		added:    _NS(),
+	}, {
+		lhs:      `{"untyped":1}`,
+		rhs:      `{"untyped":1.0}`,
+		removed:  _NS(),
+		modified: _NS(_P("untyped")),
+		added:    _NS(),
+	}, {
+		lhs:      `{"untyped":{"a":1,"b":2}}`,
+		rhs:      `{"untyped":{"b":2,"a":1}}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}},
+}, {
+	name:         "sets of atomic values",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: selectors
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: ranges
+      type:
+        list:
+          elementType:
+            list:
+              elementType:
+                scalar: integer
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: granular
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+          elementRelationship: associative
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"selectors":[{"a":"b","c":"d"}]}`,
+		rhs:      `{"selectors":[{"c":"d","a":"b"}]}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"selectors":[{"a":"b"}],"ranges":[[1,2]]}`,
+		rhs:      `{"selectors":[{"a":"c"}],"ranges":[[1,2],[3]]}`,
+		removed:  _NS(_P("selectors", mustParseValue(`{"a":"b"}`))),
+		modified: _NS(),
+		added: _NS(
+			_P("selectors", mustParseValue(`{"a":"c"}`)),
+			_P("ranges", mustParseValue(`[3]`)),
+		),
+	}},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      formerNames:
+      - containerPort
+    - name: protocol
+      type:
+        scalar: string
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"count":1,"ports":[{"containerPort":80}]}`,
+		rhs:      `{"replicas":1,"ports":[{"port":80}]}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"count":1}`,
+		rhs:      `{"replicas":2,"ports":[{"port":80}]}`,
+		removed:  _NS(),
+		modified: _NS(_P("replicas")),
+		added: _NS(
+			_P("ports"),
+			_P("ports", _KBF("port", _IV(80))),
+			_P("ports", _KBF("port", _IV(80)), "port"),
+		),
+	}},
+}, {
+	name:         "scalar formats",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: cpu
+      type:
+        scalar: string
+        constraints:
+          format: quantity
+    - name: timeout
+      type:
+        scalar: string
+        constraints:
+          format: duration
+    - name: created
+      type:
+        scalar: string
+        constraints:
+          format: date-time
+    - name: sizes
+      type:
+        list:
+          elementType:
+            scalar: string
+            constraints:
+              format: quantity
+          elementRelationship: associative
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"cpu":"1","timeout":"60s","created":"2018-10-01T12:00:00Z","sizes":["1Ki"]}`,
+		rhs:      `{"cpu":"1000m","timeout":"1m","created":"2018-10-01T14:00:00+02:00","sizes":["1024"]}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"cpu":"1","timeout":"60s","sizes":["1Ki"]}`,
+		rhs:      `{"cpu":"1001m","timeout":"61s","sizes":["1Mi"]}`,
+		removed:  _NS(_P("sizes", _SV("1024"))),
+		modified: _NS(_P("cpu"), _P("timeout")),
+		added:    _NS(_P("sizes", _SV("1048576"))),
+	}},
+}, {
+	name:         "scalar unions",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer|string
+    - name: limit
+      type:
+        scalar: numeric|string
+    - name: flag
+      type:
+        scalar: boolean|string
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"port":80,"limit":1,"flag":true}`,
+		rhs:      `{"port":80,"limit":1.0,"flag":true}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"port":80,"limit":1,"flag":true}`,
+		rhs:      `{"port":"http","limit":"1","flag":"true"}`,
+		removed:  _NS(),
+		modified: _NS(_P("port"), _P("limit"), _P("flag")),
+		added:    _NS(),
+	}, {
+		lhs:      `{"port":"http"}`,
+		rhs:      `{"port":8080,"limit":"unlimited"}`,
+		removed:  _NS(),
+		modified: _NS(_P("port")),
+		added:    _NS(_P("limit")),
+	}},
+}, {
+	name:         "positional lists",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: steps
+      type:
+        list:
+          elementType:
+            namedType: step
+          elementRelationship: positional
+- name: step
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+`,
+	quints: []symdiffQuint{{
+		lhs:      `{"args":["a","b"]}`,
+		rhs:      `{"args":["a","b","c"]}`,
+		removed:  _NS(),
+		modified: _NS(),
+		added:    _NS(_P("args", 2)),
+	}, {
+		lhs:      `{"args":["a","b","c"]}`,
+		rhs:      `{"args":["a"]}`,
+		removed:  _NS(_P("args", 1), _P("args", 2)),
+		modified: _NS(),
+		added:    _NS(),
+	}, {
+		lhs:      `{"args":["a","c"]}`,
+		rhs:      `{"args":["a","b","c"]}`,
+		removed:  _NS(),
+		modified: _NS(_P("args", 1)),
+		added:    _NS(_P("args", 2)),
+	}, {
+		lhs:      `{"steps":[{"name":"a"},{"name":"b","image":"x"}]}`,
+		rhs:      `{"steps":[{"name":"a","image":"y"},{"name":"b"}]}`,
+		removed:  _NS(_P("steps", 1, "image")),
+		modified: _NS(),
+		added:    _NS(_P("steps", 0, "image")),
+	}},
 }}
 
 func (tt symdiffTestCase) test(t *testing.T) {
@@ -540,3 +818,31 @@ func TestSymdiff(t *testing.T) {
 		})
 	}
 }
+
+// Compare reports the indices past the end of a shorter positional list as
+// removed, but doesn't truncate the merged list.
+func TestComparePositionalKeepsRemoved(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+`)
+	lhs := AsTypedUnvalidated(mustValue(t, `{"args":["a","b","c"]}`), s, "root")
+	rhs := AsTypedUnvalidated(mustValue(t, `{"args":["a"]}`), s, "root")
+	got, err := lhs.Compare(rhs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e := _NS(_P("args", 1), _P("args", 2)); !got.Removed.Equals(e) {
+		t.Errorf("expected removed:\n%s\ngot:\n%s", e, got.Removed)
+	}
+	if e, a := mustValue(t, `{"args":["a","b","c"]}`).HumanReadable(), got.Merged.AsValue().HumanReadable(); e != a {
+		t.Errorf("expected merged:\n%s\ngot:\n%s", e, a)
+	}
+}
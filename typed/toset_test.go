@@ -50,6 +50,15 @@ var (
 	_FV  = value.FloatValue
 )
 
+// mustParseValue is for values in static test tables; it panics on errors.
+func mustParseValue(y string) value.Value {
+	v, err := value.FromYAML([]byte(y))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
 var fieldsetCases = []fieldsetTestCase{{
 	name:         "simple pair",
 	rootTypeName: "stringPair",
@@ -237,6 +246,342 @@ var fieldsetCases = []fieldsetTestCase{{
 		)},
 		{`{"atomicList":["a","a","a"]}`, _NS(_P("atomicList"))},
 	},
+}, {
+	name:         "guessed untyped",
+	rootTypeName: "plugin",
+	schema: `types:
+- name: plugin
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: config
+      type:
+        untyped:
+          elementRelationship: guess
+`,
+	pairs: []objSetPair{
+		{`{"config":1}`, _NS(_P("config"))},
+		{`{"config":null}`, _NS(_P("config"))},
+		{`{"config":{"a":1,"b":{"c":"d"}}}`, _NS(
+			_P("config", "a"),
+			_P("config", "b", "c"),
+		)},
+		{`{"config":{"args":["a","b"]}}`, _NS(_P("config", "args"))},
+		{`{"config":{"containers":[{"name":"a","image":"x"},{"name":"b"}]}}`, _NS(
+			_P("config", "containers", _KBF("name", _SV("a")), "name"),
+			_P("config", "containers", _KBF("name", _SV("a")), "image"),
+			_P("config", "containers", _KBF("name", _SV("b")), "name"),
+		)},
+		{`{"config":{"containers":[{"name":"a","image":"x"},{"image":"y"}]}}`, _NS(
+			_P("config", "containers"),
+		)},
+		{`{"config":{"containers":[{"name":"a"},{"name":"a"}]}}`, _NS(
+			_P("config", "containers"),
+		)},
+		{`{"config":{"containers":[{"id":1,"name":"a"},{"id":2,"name":"a"}]}}`, _NS(
+			_P("config", "containers", _KBF("id", _IV(1), "name", _SV("a")), "id"),
+			_P("config", "containers", _KBF("id", _IV(1), "name", _SV("a")), "name"),
+			_P("config", "containers", _KBF("id", _IV(2), "name", _SV("a")), "id"),
+			_P("config", "containers", _KBF("id", _IV(2), "name", _SV("a")), "name"),
+		)},
+	},
+}, {
+	name:         "preserve unknown fields",
+	rootTypeName: "crd",
+	schema: `types:
+- name: crd
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: replicas
+            type:
+              scalar: integer
+          preserveUnknownFields: true
+`,
+	pairs: []objSetPair{
+		{`{"spec":{"replicas":1}}`, _NS(_P("spec", "replicas"))},
+		{`{"spec":{"replicas":1,"other":{"a":[1,2]}}}`, _NS(
+			_P("spec", "replicas"),
+			_P("spec", "other"),
+		)},
+	},
+}, {
+	name:         "nested and defaulted keys",
+	rootTypeName: "service",
+	schema: `types:
+- name: service
+  struct:
+    fields:
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: servicePort
+          elementRelationship: associative
+          keys:
+          - port.number
+          - protocol
+- name: servicePort
+  struct:
+    fields:
+    - name: port
+      type:
+        struct:
+          fields:
+          - name: number
+            type:
+              scalar: integer
+          - name: name
+            type:
+              scalar: string
+    - name: protocol
+      type:
+        scalar: string
+      default: TCP
+    - name: target
+      type:
+        scalar: integer
+`,
+	pairs: []objSetPair{
+		{`{"ports":[{"port":{"number":80},"protocol":"UDP"},{"port":{"number":80},"target":8080}]}`, _NS(
+			_P("ports", _KBF("port.number", _IV(80), "protocol", _SV("UDP")), "port", "number"),
+			_P("ports", _KBF("port.number", _IV(80), "protocol", _SV("UDP")), "protocol"),
+			_P("ports", _KBF("port.number", _IV(80), "protocol", _SV("TCP")), "port", "number"),
+			_P("ports", _KBF("port.number", _IV(80), "protocol", _SV("TCP")), "target"),
+		)},
+	},
+}, {
+	name:         "sets of atomic values",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: selectors
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: ranges
+      type:
+        list:
+          elementType:
+            list:
+              elementType:
+                scalar: integer
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: granular
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+          elementRelationship: associative
+`,
+	pairs: []objSetPair{
+		{`{"selectors":[{"a":"b","c":"d"},{"c":"d"}]}`, _NS(
+			_P("selectors", mustParseValue(`{"c":"d","a":"b"}`)),
+			_P("selectors", mustParseValue(`{"c":"d"}`)),
+		)},
+		{`{"ranges":[[1,2],[2,1]]}`, _NS(
+			_P("ranges", mustParseValue(`[1,2]`)),
+			_P("ranges", mustParseValue(`[2,1]`)),
+		)},
+	},
+}, {
+	name:         "map key types",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: ints
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: integer
+    - name: bools
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: boolean
+    - name: floats
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: float
+`,
+	pairs: []objSetPair{
+		{`{"ints":{"01":"a","+2":"b"},"bools":{"True":"a"},"floats":{"1.50":"a","2.0":"b"}}`, _NS(
+			_P("ints", "1"),
+			_P("ints", "2"),
+			_P("bools", "true"),
+			_P("floats", "1.5"),
+			_P("floats", "2"),
+		)},
+	},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      formerNames:
+      - containerPort
+    - name: protocol
+      type:
+        scalar: string
+`,
+	pairs: []objSetPair{
+		{`{"count":1,"ports":[{"containerPort":80,"protocol":"TCP"},{"port":53}]}`, _NS(
+			_P("replicas"),
+			_P("ports", _KBF("port", _IV(80)), "port"),
+			_P("ports", _KBF("port", _IV(80)), "protocol"),
+			_P("ports", _KBF("port", _IV(53)), "port"),
+		)},
+	},
+}, {
+	name:         "scalar formats",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: cpu
+      type:
+        scalar: string
+        constraints:
+          format: quantity
+    - name: timeout
+      type:
+        scalar: string
+        constraints:
+          format: duration
+    - name: created
+      type:
+        scalar: string
+        constraints:
+          format: date-time
+    - name: sizes
+      type:
+        list:
+          elementType:
+            scalar: string
+            constraints:
+              format: quantity
+          elementRelationship: associative
+`,
+	pairs: []objSetPair{
+		{`{"cpu":"500m","sizes":["1Ki","0.5"]}`, _NS(
+			_P("cpu"),
+			_P("sizes", _SV("1024")),
+			_P("sizes", _SV("0.5")),
+		)},
+	},
+}, {
+	name:         "positional lists",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: steps
+      type:
+        list:
+          elementType:
+            namedType: step
+          elementRelationship: positional
+- name: step
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+`,
+	pairs: []objSetPair{
+		{`{"args":["-v","-v"]}`, _NS(_P("args", 0), _P("args", 1))},
+		{`{"steps":[{"name":"a"},{"image":"b"}]}`, _NS(
+			_P("steps", 0, "name"),
+			_P("steps", 1, "image"),
+		)},
+	},
+}, {
+	// Partial objects may omit required fields.
+	name:         "required fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      required: true
+    - name: replicas
+      type:
+        scalar: integer
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: id
+            type:
+              scalar: integer
+            required: true
+          - name: size
+            type:
+              scalar: integer
+`,
+	pairs: []objSetPair{
+		{`{"replicas":3}`, _NS(_P("replicas"))},
+		{`{"name":"a","spec":{"size":1}}`, _NS(_P("name"), _P("spec", "size"))},
+	},
 }}
 
 func (tt fieldsetTestCase) test(t *testing.T) {
@@ -26,9 +26,52 @@ import (
 
 // TypedValue is a value of some specific type.
 type TypedValue struct {
-	value   value.Value
-	typeRef schema.TypeRef
-	schema  *schema.Schema
+	value    value.Value
+	typeRef  schema.TypeRef
+	schema   *schema.Schema
+	resolver TypeResolver
+
+	// defaulted lists the fields set by Default(), if it was called.
+	defaulted *fieldpath.Set
+
+	// maxDepth limits how deep values are walked; see WithMaxDepth.
+	maxDepth int
+}
+
+// DefaultMaxDepth is the maximum depth of the values that TypedValues walk,
+// unless changed with WithMaxDepth.
+const DefaultMaxDepth = 1000
+
+// WithMaxDepth returns a copy of tv which reports a validation error for any
+// value nested more than depth levels deep, rather than walking it (a value
+// of a recursive type could otherwise be arbitrarily deep). A depth of zero or
+// less restores DefaultMaxDepth.
+func (tv TypedValue) WithMaxDepth(depth int) TypedValue {
+	tv.maxDepth = depth
+	return tv
+}
+
+// errorFormatter returns an errorFormatter for walking tv.
+func (tv TypedValue) errorFormatter() errorFormatter {
+	if tv.maxDepth <= 0 {
+		return errorFormatter{maxDepth: DefaultMaxDepth}
+	}
+	return errorFormatter{maxDepth: tv.maxDepth}
+}
+
+// TypeResolver figures out the type of untyped data declared with the
+// `lookup` element relationship, e.g. from its apiVersion and kind. It returns
+// the schema the type is found in (nil means the schema of the TypedValue) and
+// a reference to the type. Resolvers that don't recognize v may return an
+// atomic untyped type to keep the default behavior for untyped data; errors
+// are reported as validation errors at the path of v.
+type TypeResolver func(v value.Value) (*schema.Schema, schema.TypeRef, error)
+
+// WithTypeResolver returns a copy of tv which uses r to find the type of any
+// `lookup` untyped data it contains.
+func (tv TypedValue) WithTypeResolver(r TypeResolver) TypedValue {
+	tv.resolver = r
+	return tv
 }
 
 // AsTyped accepts a value and a type and returns a TypedValue. 'v' must have
@@ -46,16 +89,25 @@ func AsTyped(v value.Value, s *schema.Schema, typeName string) (TypedValue, erro
 	return tv, nil
 }
 
+// AsValue returns the value of tv.
+func (tv TypedValue) AsValue() *value.Value {
+	return &tv.value
+}
+
 // Validate returns an error with a list of every spec violation.
 func (tv TypedValue) Validate() error {
-	if errs := tv.walker().validate(); len(errs) != 0 {
+	w := tv.walker()
+	w.checkRequired = true
+	if errs := w.validate(); len(errs) != 0 {
 		return errs
 	}
 	return nil
 }
 
 // ToFieldSet creates a set containing every leaf field mentioned in tv, or
-// validation errors, if any were encountered.
+// validation errors, if any were encountered. Fields set by Default() are
+// not included, since they weren't specified by whoever provided tv. Missing
+// required fields are not errors here, since tv may be a partial object.
 func (tv TypedValue) ToFieldSet() (*fieldpath.Set, error) {
 	s := fieldpath.NewSet()
 	w := tv.walker()
@@ -63,22 +115,191 @@ func (tv TypedValue) ToFieldSet() (*fieldpath.Set, error) {
 	if errs := w.validate(); len(errs) != 0 {
 		return nil, errs
 	}
+	if tv.defaulted != nil {
+		s = s.Difference(tv.defaulted)
+	}
 	return s, nil
 }
 
+// RenameFormerFields returns a copy of set, which holds paths into values of
+// the type named typeName in s, in which every former name of a struct field
+// is replaced by its current name. This lets field sets recorded before a
+// field was renamed be compared with the output of ToFieldSet().
+func RenameFormerFields(set *fieldpath.Set, s *schema.Schema, typeName string) *fieldpath.Set {
+	out := fieldpath.NewSet()
+	tr := schema.TypeRef{NamedType: &typeName}
+	set.Iterate(func(p fieldpath.Path) {
+		out.Insert(renameFormerFields(p, s, tr))
+	})
+	return out
+}
+
+func renameFormerFields(p fieldpath.Path, s *schema.Schema, tr schema.TypeRef) fieldpath.Path {
+	out := make(fieldpath.Path, 0, len(p))
+	for i, pe := range p {
+		var a schema.Atom
+		ok := false
+		if s != nil {
+			s, a, ok = s.ResolveWithSchema(tr)
+		}
+		switch {
+		case ok && a.Struct != nil && pe.FieldName != nil:
+			f := findStructFieldByAnyName(a.Struct, *pe.FieldName)
+			if f == nil {
+				return append(out, p[i:]...)
+			}
+			name := f.Name
+			pe.FieldName = &name
+			tr = f.Type
+		case ok && a.List != nil:
+			tr = a.List.ElementType
+		case ok && a.Map != nil:
+			tr = a.Map.ElementType
+		default:
+			// The rest of the path is untyped, or unknown to the
+			// schema; there is nothing to rename.
+			return append(out, p[i:]...)
+		}
+		out = append(out, pe)
+	}
+	return out
+}
+
+// Default returns a copy of tv in which every omitted struct field that has a
+// default in the schema is set to that default, recursively (defaults are
+// themselves defaulted). Null list and map elements are replaced by the
+// ElementDefault of their container, if it has one.
+//
+// The fields that were defaulted are remembered, and left out of
+// ToFieldSet(): nobody owns them until they're set explicitly.
+func (tv TypedValue) Default() (TypedValue, error) {
+	w := defaultingWalker{
+		errorFormatter: tv.errorFormatter(),
+		value:          tv.value,
+		schema:         tv.schema,
+		typeRef:        tv.typeRef,
+		resolver:       tv.resolver,
+		defaulted:      fieldpath.NewSet(),
+	}
+	if errs := w.applyDefaults(); len(errs) != 0 {
+		return TypedValue{}, errs
+	}
+	out := tv
+	out.value = w.out
+	if tv.defaulted != nil {
+		out.defaulted = tv.defaulted.Union(w.defaulted)
+	} else {
+		out.defaulted = w.defaulted
+	}
+	return out, nil
+}
+
+// Prune returns a copy of tv without the struct fields that the schema
+// doesn't describe, instead of reporting them as validation errors, along with
+// the set of paths that were dropped. Structs which preserve unknown fields
+// keep them. Other validation errors are not checked; only errors that prevent
+// walking the object (e.g. a list where a struct is expected) are returned.
+func (tv TypedValue) Prune() (TypedValue, *fieldpath.Set, error) {
+	w := pruningWalker{
+		errorFormatter: tv.errorFormatter(),
+		value:          tv.value,
+		schema:         tv.schema,
+		typeRef:        tv.typeRef,
+		resolver:       tv.resolver,
+		pruned:         fieldpath.NewSet(),
+	}
+	if errs := w.prune(); len(errs) != 0 {
+		return TypedValue{}, nil, errs
+	}
+	out := tv
+	out.value = w.out
+	return out, w.pruned, nil
+}
+
+// Normalize returns a copy of tv in canonical order, so that equal objects
+// serialize to the same bytes: struct fields are ordered as in the schema
+// (followed by any unknown fields, sorted by name), map keys are sorted
+// lexically, and the items of associative lists are ordered as listOrder
+// says. Untyped data has its map keys sorted too. Other validation errors are
+// not checked; only errors that prevent walking the object are returned.
+func (tv TypedValue) Normalize(listOrder ListOrder) (TypedValue, error) {
+	w := normalizingWalker{
+		errorFormatter: tv.errorFormatter(),
+		value:          tv.value,
+		schema:         tv.schema,
+		typeRef:        tv.typeRef,
+		resolver:       tv.resolver,
+		listOrder:      listOrder,
+	}
+	if errs := w.normalize(); len(errs) != 0 {
+		return TypedValue{}, errs
+	}
+	out := tv
+	out.value = w.out
+	return out, nil
+}
+
+// MergeOption changes the behavior of Merge and Compare.
+type MergeOption func(*mergeOptions)
+
+type mergeOptions struct {
+	enforceImmutability bool
+	deleteNulls         bool
+
+	normalize bool
+	listOrder ListOrder
+}
+
+// EnforceImmutability makes Merge and Compare return a validation error for
+// every immutable field (see schema.StructField.Immutable) that the rhs
+// changes, giving the old and new values. Immutable fields which are unset
+// (or null) in tv may still be set. Compare also reports immutable fields
+// which are missing from the rhs, since it compares complete objects.
+func EnforceImmutability() MergeOption {
+	return func(o *mergeOptions) {
+		o.enforceImmutability = true
+	}
+}
+
+// DeleteNulls makes Merge and Compare follow the JSON merge patch rules of
+// RFC 7386: a null in the rhs removes the value it replaces, with everything
+// below it, instead of setting it to null. This applies to struct fields, map
+// items and the fields of associative list items, at any depth. A map or list
+// whose items are all removed is kept, empty. Nulls at the end of a positional
+// list remove the items at their indices, truncating it; a null before an item
+// which stays is an error. Atomic values are still replaced as a whole, along
+// with any nulls they contain.
+func DeleteNulls() MergeOption {
+	return func(o *mergeOptions) {
+		o.deleteNulls = true
+	}
+}
+
+// NormalizeOutput makes Merge and Compare return merged objects which are
+// normalized, as by Normalize(listOrder).
+func NormalizeOutput(listOrder ListOrder) MergeOption {
+	return func(o *mergeOptions) {
+		o.normalize = true
+		o.listOrder = listOrder
+	}
+}
+
 // Merge returns the result of merging tv and pso ("partially specified
 // object") together. Of note:
-//  * No fields can be removed by this operation.
+//  * No fields can be removed by this operation, except with DeleteNulls().
 //  * If both tv and pso specify a given leaf field, the result will keep pso's
 //    value.
-//  * Container typed elements will have their items ordered:
-//    * like tv, if pso doesn't change anything in the container
-//    * like pso, if pso does change something in the container.
+//  * Associative lists will have their items ordered like pso, for the items
+//    that pso mentions; items only found in tv follow the item they follow
+//    in tv (or lead the list, if no item of tv before them is in pso).
+//  * Structs will have their fields in schema order, and maps tv's keys
+//    followed by the keys that only pso has.
 // tv and pso must both be of the same type (their Schema and TypeRef must
-// match), or an error will be returned. Validation errors will be returned if
+// match, or refer to the same type of a schema.Registry), or an error will be
+// returned. Validation errors will be returned if
 // the objects don't conform to the schema.
-func (tv TypedValue) Merge(pso TypedValue) (TypedValue, error) {
-	return merge(tv, pso, ruleKeepRHS, nil)
+func (tv TypedValue) Merge(pso TypedValue, opts ...MergeOption) (TypedValue, error) {
+	return merge(tv, pso, ruleKeepRHS, nil, false, opts)
 }
 
 // Comparison is the return value of a TypedValue.Compare() operation.
@@ -103,9 +324,10 @@ type Comparison struct {
 // struct for details on the return value.
 //
 // tv and rhs must both be of the same type (their Schema and TypeRef must
-// match), or an error will be returned. Validation errors will be returned if
+// match, or refer to the same type of a schema.Registry), or an error will be
+// returned. Validation errors will be returned if
 // the objects don't conform to the schema.
-func (tv TypedValue) Compare(rhs TypedValue) (c *Comparison, err error) {
+func (tv TypedValue) Compare(rhs TypedValue, opts ...MergeOption) (c *Comparison, err error) {
 	c = &Comparison{
 		Removed:  fieldpath.NewSet(),
 		Modified: fieldpath.NewSet(),
@@ -116,9 +338,7 @@ func (tv TypedValue) Compare(rhs TypedValue) (c *Comparison, err error) {
 			c.Added.Insert(w.path)
 		} else if w.rhs == nil {
 			c.Removed.Insert(w.path)
-		} else if !reflect.DeepEqual(w.rhs, w.lhs) {
-			// TODO: reflect.DeepEqual is not sufficient for this.
-			// Need to implement equality check on the value type.
+		} else if !w.leafEqual() {
 			c.Modified.Insert(w.path)
 		}
 
@@ -129,7 +349,7 @@ func (tv TypedValue) Compare(rhs TypedValue) (c *Comparison, err error) {
 		} else if w.rhs == nil {
 			c.Removed.Insert(w.path)
 		}
-	})
+	}, true, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -137,41 +357,103 @@ func (tv TypedValue) Compare(rhs TypedValue) (c *Comparison, err error) {
 	return c, nil
 }
 
-func merge(lhs, rhs TypedValue, rule, postRule mergeRule) (TypedValue, error) {
-	if lhs.schema != rhs.schema {
-		return TypedValue{}, errorFormatter{}.
-			errorf("expected objects with types from the same schema")
+// merge merges lhs and rhs. If rhsIsComplete is set, fields missing from rhs
+// are considered removed rather than unspecified.
+func merge(lhs, rhs TypedValue, rule, postRule mergeRule, rhsIsComplete bool, opts []MergeOption) (TypedValue, error) {
+	var o mergeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if lhs.schema != rhs.schema || !reflect.DeepEqual(lhs.typeRef, rhs.typeRef) {
+		// The objects may still be of the same type, if they refer
+		// to it from different schemas of a registry.
+		ls, lname, lok := resolveTypeName(lhs.schema, lhs.typeRef)
+		rs, rname, rok := resolveTypeName(rhs.schema, rhs.typeRef)
+		if lhs.schema != rhs.schema && (!lok || !rok || ls != rs) {
+			return TypedValue{}, errorFormatter{}.
+				errorf("expected objects with types from the same schema")
+		}
+		if !lok || !rok || lname != rname {
+			return TypedValue{}, errorFormatter{}.
+				errorf("expected objects of the same type, but got %v and %v", lhs.typeRef, rhs.typeRef)
+		}
+	}
+
+	resolver := lhs.resolver
+	if resolver == nil {
+		resolver = rhs.resolver
 	}
-	if !reflect.DeepEqual(lhs.typeRef, rhs.typeRef) {
-		return TypedValue{}, errorFormatter{}.
-			errorf("expected objects of the same type, but got %v and %v", lhs.typeRef, rhs.typeRef)
+
+	// The stricter limit of the two applies.
+	ef := lhs.errorFormatter()
+	if ref := rhs.errorFormatter(); ref.maxDepth < ef.maxDepth {
+		ef = ref
+	}
+
+	var violations ValidationErrors
+	if o.enforceImmutability {
+		rule = ruleCheckImmutable(rule, rhsIsComplete, &violations)
 	}
 
+	// Defaulted fields stay unowned, unless rhs sets them.
+	rhsSet := fieldpath.NewSet()
+	rule, postRule = ruleTrackRHS(rule, rhsSet), ruleTrackRHS(postRule, rhsSet)
+
 	mw := mergingWalker{
-		lhs:          &lhs.value,
-		rhs:          &rhs.value,
-		schema:       lhs.schema,
-		typeRef:      lhs.typeRef,
-		rule:         rule,
-		postItemHook: postRule,
-	}
-	errs := mw.merge()
+		errorFormatter: ef,
+		lhs:            &lhs.value,
+		rhs:            &rhs.value,
+		schema:         lhs.schema,
+		typeRef:        lhs.typeRef,
+		resolver:       resolver,
+		rule:           rule,
+		postItemHook:   postRule,
+		deleteNulls:    o.deleteNulls,
+	}
+	errs := append(mw.merge(), violations...)
 	if len(errs) > 0 {
 		return TypedValue{}, errs
 	}
 
 	out := TypedValue{
-		schema:  lhs.schema,
-		typeRef: lhs.typeRef,
+		schema:   lhs.schema,
+		typeRef:  lhs.typeRef,
+		resolver: resolver,
+		maxDepth: ef.maxDepth,
 	}
 	if mw.out == nil {
 		out.value = value.Value{Null: true}
 	} else {
 		out.value = *mw.out
 	}
+	if lhs.defaulted != nil {
+		out.defaulted = lhs.defaulted.Difference(rhsSet)
+	}
+	if rhs.defaulted != nil {
+		if out.defaulted == nil {
+			out.defaulted = rhs.defaulted
+		} else {
+			out.defaulted = out.defaulted.Union(rhs.defaulted)
+		}
+	}
+	if o.normalize {
+		return out.Normalize(o.listOrder)
+	}
 	return out, nil
 }
 
+// resolveTypeName returns the schema which defines the named type tr refers
+// to, and its unqualified name there. Inlined types have no name, so they're
+// only the same type if their references are equal.
+func resolveTypeName(s *schema.Schema, tr schema.TypeRef) (*schema.Schema, string, bool) {
+	if s == nil || tr.NamedType == nil {
+		return nil, "", false
+	}
+	s2, t, ok := s.FindNamedTypeWithSchema(*tr.NamedType)
+	return s2, t.Name, ok
+}
+
 // AsTypeUnvalidated is just like WithType, but doesn't validate that the type
 // conforms to the schema, for cases where that has already been checked or
 // where you're going to call a method that validates as a side-effect (like
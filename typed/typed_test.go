@@ -0,0 +1,285 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+
+	"gopkg.in/yaml.v2"
+)
+
+func mustSchema(t *testing.T, y string) *schema.Schema {
+	var s schema.Schema
+	if err := yaml.Unmarshal([]byte(y), &s); err != nil {
+		t.Fatalf("unable to unmarshal schema: %v", err)
+	}
+	return &s
+}
+
+func mustValue(t *testing.T, y string) value.Value {
+	v, err := value.FromYAML([]byte(y))
+	if err != nil {
+		t.Fatalf("unable to interpret yaml: %v\n%v", err, y)
+	}
+	return v
+}
+
+var metaSchema = `package: meta
+types:
+- name: ObjectMeta
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: labels
+      type:
+        namedType: Labels
+- name: Labels
+  map:
+    elementType:
+      scalar: string
+`
+
+var appsSchema = `package: apps
+types:
+- name: Deployment
+  struct:
+    fields:
+    - name: metadata
+      type:
+        namedType: meta.ObjectMeta
+    - name: replicas
+      type:
+        scalar: integer
+`
+
+func TestCrossSchemaReferences(t *testing.T) {
+	meta := mustSchema(t, metaSchema)
+	apps := mustSchema(t, appsSchema)
+	if _, err := schema.NewRegistry(meta, apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj := mustValue(t, `{"metadata":{"name":"a","labels":{"app":"a"}},"replicas":1}`)
+	tv, err := AsTyped(obj, apps, "Deployment")
+	if err != nil {
+		t.Fatalf("got validation errors: %v", err)
+	}
+	fs, err := tv.ToFieldSet()
+	if err != nil {
+		t.Fatalf("got validation errors: %v", err)
+	}
+	expect := _NS(
+		_P("metadata", "name"),
+		_P("metadata", "labels", "app"),
+		_P("replicas"),
+	)
+	if !fs.Equals(expect) {
+		t.Errorf("wanted\n%s\ngot\n%s", expect, fs)
+	}
+
+	if _, err := AsTyped(mustValue(t, `{"metadata":{"labels":{"app":1}}}`), apps, "Deployment"); err == nil {
+		t.Errorf("expected validation errors from the referenced schema")
+	}
+
+	// ObjectMeta values typed through either schema can be merged.
+	lhs, err := AsTyped(mustValue(t, `{"name":"a","labels":{"a":"b"}}`), apps, "meta.ObjectMeta")
+	if err != nil {
+		t.Fatalf("got validation errors: %v", err)
+	}
+	rhs, err := AsTyped(mustValue(t, `{"labels":{"c":"d"}}`), meta, "ObjectMeta")
+	if err != nil {
+		t.Fatalf("got validation errors: %v", err)
+	}
+	got, err := lhs.Merge(rhs)
+	if err != nil {
+		t.Fatalf("got merge errors: %v", err)
+	}
+	out := mustValue(t, `{"name":"a","labels":{"a":"b","c":"d"}}`)
+	if !reflect.DeepEqual(got.value.ToUnstructured(true), out.ToUnstructured(true)) {
+		t.Errorf("expected\n%v\nbut got\n%v", out.HumanReadable(), got.value.HumanReadable())
+	}
+
+	// But not with a different type.
+	if _, err := lhs.Merge(AsTypedUnvalidated(obj, apps, "Deployment")); err == nil {
+		t.Errorf("expected an error merging different types")
+	}
+	unregistered := mustSchema(t, metaSchema)
+	if _, err := lhs.Merge(AsTypedUnvalidated(obj, unregistered, "ObjectMeta")); err == nil {
+		t.Errorf("expected an error merging types from unrelated schemas")
+	}
+}
+
+func TestMergeTypeIdentity(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: a
+  struct:
+    fields:
+    - name: x
+      type:
+        scalar: string
+- name: b
+  struct:
+    fields:
+    - name: x
+      type:
+        scalar: string
+`)
+	obj := mustValue(t, `{"x":"1"}`)
+	a := AsTypedUnvalidated(obj, s, "a")
+
+	if _, err := a.Merge(AsTypedUnvalidated(obj, s, "a")); err != nil {
+		t.Errorf("unexpected error merging the same type: %v", err)
+	}
+	// Types of the same shape are still different types.
+	if _, err := a.Merge(AsTypedUnvalidated(obj, s, "b")); err == nil {
+		t.Errorf("expected an error merging different types of the same shape")
+	}
+	if _, err := a.Merge(AsTypedUnvalidated(obj, nil, "a")); err == nil {
+		t.Errorf("expected an error merging a value without a schema")
+	}
+	if _, err := AsTypedUnvalidated(obj, nil, "a").Merge(AsTypedUnvalidated(obj, nil, "b")); err == nil {
+		t.Errorf("expected an error merging values without a schema")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: node
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: child
+      type:
+        namedType: node
+`)
+	nested := `{"name":"leaf"}`
+	for i := 0; i < 20; i++ {
+		nested = `{"child":` + nested + `}`
+	}
+	tv := AsTypedUnvalidated(mustValue(t, nested), s, "node")
+
+	if err := tv.Validate(); err != nil {
+		t.Fatalf("unexpected error with the default depth: %v", err)
+	}
+
+	shallow := tv.WithMaxDepth(10)
+	if err := shallow.Validate(); err == nil || !strings.Contains(err.Error(), "maximum depth") {
+		t.Errorf("expected a maximum depth error from Validate, got %v", err)
+	}
+	if _, err := shallow.Merge(tv); err == nil {
+		t.Errorf("expected a maximum depth error from Merge")
+	}
+	if _, err := shallow.Default(); err == nil {
+		t.Errorf("expected a maximum depth error from Default")
+	}
+	if _, _, err := shallow.Prune(); err == nil {
+		t.Errorf("expected a maximum depth error from Prune")
+	}
+}
+
+func TestDefaultRecursionIsBounded(t *testing.T) {
+	// Every node defaults its child to an empty node, forever.
+	s := mustSchema(t, `types:
+- name: node
+  struct:
+    fields:
+    - name: child
+      type:
+        namedType: node
+      default: {}
+`)
+	_, err := AsTypedUnvalidated(mustValue(t, `{}`), s, "node").Default()
+	if err == nil || !strings.Contains(err.Error(), "maximum depth") {
+		t.Errorf("expected a maximum depth error, got %v", err)
+	}
+}
+
+func TestRenameFormerFields(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: root
+  struct:
+    fields:
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: replicas
+            type:
+              scalar: integer
+            formerNames:
+            - count
+          - name: ports
+            type:
+              list:
+                elementType:
+                  struct:
+                    fields:
+                    - name: port
+                      type:
+                        scalar: integer
+                      formerNames:
+                      - containerPort
+                elementRelationship: associative
+                keys:
+                - port
+      formerNames:
+      - specification
+    - name: config
+      type:
+        untyped: {}
+`)
+	old := _NS(
+		_P("specification", "count"),
+		_P("spec", "ports", _KBF("port", _IV(80)), "containerPort"),
+		_P("config", "count"),
+		_P("unknown", "count"),
+	)
+	expect := _NS(
+		_P("spec", "replicas"),
+		_P("spec", "ports", _KBF("port", _IV(80)), "port"),
+		_P("config", "count"),
+		_P("unknown", "count"),
+	)
+	got := RenameFormerFields(old, s, "root")
+	if !got.Equals(expect) {
+		t.Errorf("expected\n%v\ngot\n%v", expect, got)
+	}
+
+	// Objects which still use the old names are owned under the new
+	// ones.
+	tv := AsTypedUnvalidated(mustValue(t, `{"specification":{"count":1,"ports":[{"containerPort":80}]}}`), s, "root")
+	fs, err := tv.ToFieldSet()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect = _NS(
+		_P("spec", "replicas"),
+		_P("spec", "ports", _KBF("port", _IV(80)), "port"),
+	)
+	if !fs.Equals(expect) {
+		t.Errorf("expected\n%v\ngot\n%v", expect, fs)
+	}
+}
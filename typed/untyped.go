@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+var (
+	atomicUntyped = schema.TypeRef{Inlined: schema.Atom{
+		Untyped: &schema.Untyped{ElementRelationship: schema.Atomic},
+	}}
+	guessedUntyped = schema.TypeRef{Inlined: schema.Atom{
+		Untyped: &schema.Untyped{ElementRelationship: schema.Guess},
+	}}
+)
+
+// lookupType calls the resolver to find the type of v, which was declared
+// with the `lookup` element relationship in schema s.
+func (ef errorFormatter) lookupType(r TypeResolver, s *schema.Schema, v value.Value) (*schema.Schema, schema.TypeRef, ValidationErrors) {
+	if r == nil {
+		return nil, schema.TypeRef{}, ef.errorf("schema error: untyped data requires a lookup, but no type resolver was provided")
+	}
+	s2, tr, err := r(v)
+	if err != nil {
+		return nil, schema.TypeRef{}, ef.prefixError("type lookup failed: ", err)
+	}
+	if s2 == nil {
+		s2 = s
+	}
+	if _, a, ok := s2.ResolveWithSchema(tr); ok && a.Untyped != nil && a.Untyped.ElementRelationship == schema.Lookup {
+		// This would recurse forever.
+		return nil, schema.TypeRef{}, ef.errorf("schema error: type lookup returned another lookup type")
+	}
+	return s2, tr, nil
+}
+
+// guessUntypedType returns the type to use for untyped data with the `guess`
+// element relationship, given all the values found at that spot (nil values
+// are ignored, so that lhs and rhs of a merge can be passed directly):
+//  * maps become separable maps of guessed values;
+//  * lists whose items are all maps that fieldpath.GuessBestListPathElement
+//    keys by the same fields become associative lists of guessed values;
+//  * anything else, including values of different kinds, is atomic.
+func guessUntypedType(values ...*value.Value) schema.TypeRef {
+	var maps, lists int
+	for _, v := range values {
+		switch {
+		case v == nil, v.Null:
+			continue
+		case v.Map != nil:
+			maps++
+		case v.List != nil:
+			lists++
+		default:
+			return atomicUntyped
+		}
+	}
+
+	switch {
+	case maps > 0 && lists == 0:
+		return schema.TypeRef{Inlined: schema.Atom{Map: &schema.Map{
+			ElementType: guessedUntyped,
+		}}}
+	case lists > 0 && maps == 0:
+		var ls []*value.List
+		for _, v := range values {
+			if v != nil && v.List != nil {
+				ls = append(ls, v.List)
+			}
+		}
+		if keys := fieldpath.GuessListKeys(ls...); len(keys) > 0 {
+			return schema.TypeRef{Inlined: schema.Atom{List: &schema.List{
+				ElementType:         guessedUntyped,
+				ElementRelationship: schema.Associative,
+				Keys:                keys,
+			}}}
+		}
+	}
+	return atomicUntyped
+}
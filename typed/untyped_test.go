@@ -0,0 +1,219 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package typed
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/schema"
+	"sigs.k8s.io/structured-merge-diff/value"
+)
+
+var lookupParentSchema = `types:
+- name: wrapper
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: object
+      type:
+        untyped:
+          elementRelationship: lookup
+- name: widget
+  struct:
+    fields:
+    - name: kind
+      type:
+        scalar: string
+    - name: size
+      type:
+        scalar: integer
+    - name: color
+      type:
+        scalar: string
+`
+
+var lookupOtherSchema = `types:
+- name: gadget
+  struct:
+    fields:
+    - name: kind
+      type:
+        scalar: string
+    - name: parts
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: associative
+`
+
+func kindResolver(other *schema.Schema) TypeResolver {
+	return func(v value.Value) (*schema.Schema, schema.TypeRef, error) {
+		if v.Map == nil {
+			return nil, schema.TypeRef{}, fmt.Errorf("expected an object, got %v", v.HumanReadable())
+		}
+		kind, ok := v.Map.Get("kind")
+		if !ok || kind.Value.String == nil {
+			return nil, atomicUntyped, nil
+		}
+		name := string(*kind.Value.String)
+		switch name {
+		case "widget":
+			return nil, schema.TypeRef{NamedType: &name}, nil
+		case "gadget":
+			return other, schema.TypeRef{NamedType: &name}, nil
+		}
+		return nil, schema.TypeRef{}, fmt.Errorf("unknown kind %q", name)
+	}
+}
+
+func TestLookupValidate(t *testing.T) {
+	s := mustSchema(t, lookupParentSchema)
+	r := kindResolver(mustSchema(t, lookupOtherSchema))
+
+	valid := []string{
+		`{"name":"a"}`,
+		`{"object":null}`,
+		`{"object":{"kind":"widget","size":1}}`,
+		`{"object":{"kind":"gadget","parts":["a","b"]}}`,
+		`{"object":{"anything":["goes"]}}`,
+	}
+	for _, y := range valid {
+		if err := AsTypedUnvalidated(mustValue(t, y), s, "wrapper").WithTypeResolver(r).Validate(); err != nil {
+			t.Errorf("%v: got validation errors: %v", y, err)
+		}
+	}
+
+	invalid := []string{
+		`{"object":1}`,
+		`{"object":{"kind":"doohickey"}}`,
+		`{"object":{"kind":"widget","size":"big"}}`,
+		`{"object":{"kind":"gadget","size":1}}`,
+		`{"object":{"kind":"gadget","parts":["a","a"]}}`,
+	}
+	for _, y := range invalid {
+		if err := AsTypedUnvalidated(mustValue(t, y), s, "wrapper").WithTypeResolver(r).Validate(); err == nil {
+			t.Errorf("%v: didn't get validation errors!", y)
+		}
+	}
+
+	if err := AsTypedUnvalidated(mustValue(t, valid[2]), s, "wrapper").Validate(); err == nil {
+		t.Errorf("expected an error without a type resolver")
+	}
+}
+
+func TestLookupToFieldSet(t *testing.T) {
+	s := mustSchema(t, lookupParentSchema)
+	r := kindResolver(mustSchema(t, lookupOtherSchema))
+
+	cases := []objSetPair{
+		{`{"object":null}`, _NS(_P("object"))},
+		{`{"object":{"kind":"widget","size":1}}`, _NS(
+			_P("object", "kind"),
+			_P("object", "size"),
+		)},
+		{`{"object":{"kind":"gadget","parts":["a","b"]}}`, _NS(
+			_P("object", "kind"),
+			_P("object", "parts", _SV("a")),
+			_P("object", "parts", _SV("b")),
+		)},
+		{`{"object":{"other":{"a":"b"}}}`, _NS(_P("object"))},
+	}
+	for _, tt := range cases {
+		fs, err := AsTypedUnvalidated(mustValue(t, tt.object), s, "wrapper").WithTypeResolver(r).ToFieldSet()
+		if err != nil {
+			t.Errorf("%v: got validation errors: %v", tt.object, err)
+			continue
+		}
+		if !fs.Equals(tt.set) {
+			t.Errorf("%v: wanted\n%s\ngot\n%s\n", tt.object, tt.set, fs)
+		}
+	}
+}
+
+func TestLookupMerge(t *testing.T) {
+	s := mustSchema(t, lookupParentSchema)
+	r := kindResolver(mustSchema(t, lookupOtherSchema))
+
+	cases := []struct {
+		lhs, rhs, out string
+		modified      *fieldpath.Set
+	}{{
+		`{"object":{"kind":"widget","size":1,"color":"red"}}`,
+		`{"object":{"kind":"widget","size":2}}`,
+		`{"object":{"kind":"widget","size":2,"color":"red"}}`,
+		_NS(_P("object", "size")),
+	}, {
+		`{"object":{"kind":"gadget","parts":["a"]}}`,
+		`{"object":{"kind":"gadget","parts":["b"]}}`,
+		`{"object":{"kind":"gadget","parts":["a","b"]}}`,
+		_NS(),
+	}, {
+		`{"object":{"kind":"widget","size":1}}`,
+		`{"object":{"kind":"gadget","parts":["b"]}}`,
+		`{"object":{"kind":"gadget","parts":["b"]}}`,
+		_NS(_P("object")),
+	}, {
+		`{"name":"a"}`,
+		`{"object":{"kind":"widget","size":2}}`,
+		`{"name":"a","object":{"kind":"widget","size":2}}`,
+		_NS(),
+	}}
+	for _, tt := range cases {
+		lhs := AsTypedUnvalidated(mustValue(t, tt.lhs), s, "wrapper").WithTypeResolver(r)
+		rhs := AsTypedUnvalidated(mustValue(t, tt.rhs), s, "wrapper")
+		got, err := lhs.Compare(rhs)
+		if err != nil {
+			t.Errorf("%v + %v: got validation errors: %v", tt.lhs, tt.rhs, err)
+			continue
+		}
+		expect := mustValue(t, tt.out)
+		if !reflect.DeepEqual(got.Merged.value.ToUnstructured(true), expect.ToUnstructured(true)) {
+			t.Errorf("%v + %v: expected\n%v\nbut got\n%v", tt.lhs, tt.rhs,
+				expect.HumanReadable(), got.Merged.value.HumanReadable())
+		}
+		if !got.Modified.Equals(tt.modified) {
+			t.Errorf("%v + %v: expected modified\n%s\nbut got\n%s", tt.lhs, tt.rhs, tt.modified, got.Modified)
+		}
+	}
+}
+
+func TestLookupReturningQualifiedLookup(t *testing.T) {
+	parent := mustSchema(t, "package: parent\n"+lookupParentSchema)
+	shared := mustSchema(t, `package: shared
+types:
+- name: Any
+  untyped:
+    elementRelationship: lookup
+`)
+	if _, err := schema.NewRegistry(parent, shared); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := func(v value.Value) (*schema.Schema, schema.TypeRef, error) {
+		name := "shared.Any"
+		return nil, schema.TypeRef{NamedType: &name}, nil
+	}
+	err := AsTypedUnvalidated(mustValue(t, `{"object":{"a":"b"}}`), parent, "wrapper").WithTypeResolver(r).Validate()
+	if err == nil {
+		t.Errorf("expected an error for a lookup returning another lookup type")
+	}
+}
@@ -24,17 +24,20 @@ import (
 
 func (tv TypedValue) walker() *validatingObjectWalker {
 	return &validatingObjectWalker{
-		value:   tv.value,
-		schema:  tv.schema,
-		typeRef: tv.typeRef,
+		errorFormatter: tv.errorFormatter(),
+		value:          tv.value,
+		schema:         tv.schema,
+		typeRef:        tv.typeRef,
+		resolver:       tv.resolver,
 	}
 }
 
 type validatingObjectWalker struct {
 	errorFormatter
-	value   value.Value
-	schema  *schema.Schema
-	typeRef schema.TypeRef
+	value    value.Value
+	schema   *schema.Schema
+	typeRef  schema.TypeRef
+	resolver TypeResolver
 
 	// If set, this is called on "leaf fields":
 	//  * scalars: int/string/float/bool
@@ -42,12 +45,21 @@ type validatingObjectWalker struct {
 	//  * untyped fields
 	leafFieldCallback func(fieldpath.Path)
 
+	// If set, missing required struct fields are errors.
+	checkRequired bool
+
 	// internal housekeeping--don't set when constructing.
 	inLeaf bool // Set to true if we're in a "big leaf"--atomic map/list
 }
 
 func (v validatingObjectWalker) validate() ValidationErrors {
-	return resolveSchema(v.schema, v.typeRef, v)
+	s, a, errs := v.resolveSchema(v.schema, v.typeRef)
+	if len(errs) > 0 {
+		return errs
+	}
+	v.schema = s
+	errs = handleAtom(a, v)
+	return append(errs, v.validateConstraints(a, v.value)...)
 }
 
 // doLeaf should be called on leaves before descending into children, if there
@@ -79,26 +91,55 @@ func (v validatingObjectWalker) doScalar(t schema.Scalar) ValidationErrors {
 }
 
 func (v validatingObjectWalker) visitStructFields(t schema.Struct, m *value.Map) (errs ValidationErrors) {
-	allowedNames := map[string]struct{}{}
+	allowedNames := structFieldNames(t)
 	for i := range t.Fields {
 		// I don't want to use the loop variable since a reference
 		// might outlive the loop iteration (in an error message).
 		f := t.Fields[i]
-		allowedNames[f.Name] = struct{}{}
-		child, ok := m.Get(f.Name)
-		if !ok {
-			// All fields are optional
-			continue
-		}
 		v2 := v
+		// Fields are always reported under their current name.
 		v2.errorFormatter.descend(fieldpath.PathElement{FieldName: &f.Name})
+		child, err := structFieldItem(m, f)
+		if err != nil {
+			errs = append(errs, v2.error(err)...)
+			continue
+		}
+		if child == nil {
+			if f.Required && v.checkRequired {
+				errs = append(errs, v2.errorf("required field is missing")...)
+			}
+			continue
+		}
+		if child.Value.Null && f.Nullable != nil {
+			if !*f.Nullable {
+				errs = append(errs, v2.errorf("field may not be null")...)
+			} else {
+				// An explicit null is a leaf, whatever the type.
+				v2.doLeaf()
+			}
+			continue
+		}
 		v2.value = child.Value
 		v2.typeRef = f.Type
 		errs = append(errs, v2.validate()...)
 	}
 
-	// All fields may be optional, but unknown fields are not allowed.
-	return append(errs, v.rejectExtraStructFields(m, allowedNames, "")...)
+	if !t.PreserveUnknownFields {
+		// Unknown fields are not allowed.
+		return append(errs, v.rejectExtraStructFields(m, allowedNames, "")...)
+	}
+	for _, f := range m.Items {
+		if _, known := allowedNames[f.Name]; known {
+			continue
+		}
+		name := f.Name
+		v2 := v
+		v2.errorFormatter.descend(fieldpath.PathElement{FieldName: &name})
+		v2.value = f.Value
+		v2.typeRef = atomicUntyped
+		errs = append(errs, v2.validate()...)
+	}
+	return errs
 }
 
 func (v validatingObjectWalker) doStruct(t schema.Struct) (errs ValidationErrors) {
@@ -126,7 +167,7 @@ func (v validatingObjectWalker) doStruct(t schema.Struct) (errs ValidationErrors
 func (v validatingObjectWalker) visitListItems(t schema.List, list *value.List) (errs ValidationErrors) {
 	observedKeys := map[string]struct{}{}
 	for i, child := range list.Items {
-		pe, err := listItemToPathElement(t, i, child)
+		pe, err := listItemToPathElement(v.schema, t, i, child)
 		if err != nil {
 			errs = append(errs, v.errorf("element %v: %v", i, err.Error())...)
 			// If we can't construct the path element, we can't
@@ -168,9 +209,18 @@ func (v validatingObjectWalker) doList(t schema.List) (errs ValidationErrors) {
 }
 
 func (v validatingObjectWalker) visitMapItems(t schema.Map, m *value.Map) (errs ValidationErrors) {
+	observedKeys := map[string]struct{}{}
 	for _, item := range m.Items {
 		v2 := v
-		name := item.Name
+		name, err := canonicalMapKey(t, item.Name)
+		if err != nil {
+			errs = append(errs, v.error(err)...)
+			continue
+		}
+		if _, found := observedKeys[name]; found {
+			errs = append(errs, v.errorf("duplicate entries for key %q", name)...)
+		}
+		observedKeys[name] = struct{}{}
 		v2.errorFormatter.descend(fieldpath.PathElement{FieldName: &name})
 		v2.value = item.Value
 		v2.typeRef = t.ElementType
@@ -199,6 +249,21 @@ func (v validatingObjectWalker) doMap(t schema.Map) (errs ValidationErrors) {
 }
 
 func (v validatingObjectWalker) doUntyped(t schema.Untyped) (errs ValidationErrors) {
+	if t.ElementRelationship == schema.Guess {
+		return handleAtom(guessUntypedType(&v.value).Inlined, v)
+	}
+	if t.ElementRelationship == schema.Lookup {
+		if v.value.Null {
+			// There is nothing to look up.
+			v.doLeaf()
+			return nil
+		}
+		v.schema, v.typeRef, errs = v.lookupType(v.resolver, v.schema, v.value)
+		if len(errs) > 0 {
+			return errs
+		}
+		return v.validate()
+	}
 	if t.ElementRelationship == "" || t.ElementRelationship == schema.Atomic {
 		// Untyped sections allow anything, and are considered leaf
 		// fields.
@@ -225,6 +225,509 @@ var validationCases = []validationTestCase{{
 		`{"list":[{"key":"a","id":1,"value":{"a":"a"},"bv":"true","nv":3.14}]}`,
 		`{"list":[{"key":"a","id":1,"value":{"a":"a"},"bv":true,"nv":false}]}`,
 	},
+}, {
+	name:         "integer and float",
+	rootTypeName: "myStruct",
+	schema: `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: int
+      type:
+        scalar: integer
+    - name: float
+      type:
+        scalar: float
+    - name: setInt
+      type:
+        list:
+          elementType:
+            scalar: integer
+          elementRelationship: associative
+`,
+	validObjects: []string{
+		`{"int":1}`,
+		`{"int":-3}`,
+		`{"int":2.0}`,
+		`{"float":1}`,
+		`{"float":1.5}`,
+		`{"setInt":[1,2,3]}`,
+	},
+	invalidObjects: []string{
+		`{"int":1.5}`,
+		`{"int":"1"}`,
+		`{"int":true}`,
+		`{"int":null}`,
+		`{"int":.inf}`,
+		`{"float":"1.5"}`,
+		`{"float":null}`,
+		`{"setInt":[1,2.5]}`,
+	},
+}, {
+	name:         "guessed untyped",
+	rootTypeName: "plugin",
+	schema: `types:
+- name: plugin
+  struct:
+    fields:
+    - name: config
+      type:
+        untyped:
+          elementRelationship: guess
+`,
+	validObjects: []string{
+		`{"config":null}`,
+		`{"config":"a"}`,
+		`{"config":{"a":[1,"b",{"c":null}]}}`,
+		`{"config":{"list":[{"name":"a"},{"name":"a"}]}}`,
+		`{"config":{"list":[{"name":"a"},{"key":"a"}]}}`,
+	},
+	invalidObjects: []string{
+		`{"config":1,"other":2}`,
+	},
+}, {
+	name:         "required and nullable",
+	rootTypeName: "myStruct",
+	schema: `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+      required: true
+    - name: nullableString
+      type:
+        scalar: string
+      nullable: true
+    - name: nonNullableMap
+      type:
+        map:
+          elementType:
+            scalar: string
+      nullable: false
+    - name: nested
+      type:
+        struct:
+          fields:
+          - name: id
+            type:
+              scalar: integer
+            required: true
+`,
+	validObjects: []string{
+		`{"name":"a"}`,
+		`{"name":"a","nullableString":null}`,
+		`{"name":"a","nullableString":"b"}`,
+		`{"name":"a","nonNullableMap":{}}`,
+		`{"name":"a","nested":{"id":1}}`,
+		`{"name":"a","nested":null}`,
+	},
+	invalidObjects: []string{
+		`{}`,
+		`{"nullableString":"b"}`,
+		`{"name":null}`,
+		`{"name":"a","nullableString":1}`,
+		`{"name":"a","nonNullableMap":null}`,
+		`{"name":"a","nested":{}}`,
+	},
+}, {
+	name:         "constraints",
+	rootTypeName: "myStruct",
+	schema: `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: enum
+      type:
+        scalar: string
+        constraints:
+          enum: [a, b]
+    - name: numericEnum
+      type:
+        scalar: numeric
+        constraints:
+          enum: [1, 2.5]
+    - name: name
+      type:
+        scalar: string
+        constraints:
+          pattern: '^[a-z]+$'
+          minLength: 2
+          maxLength: 4
+    - name: port
+      type:
+        scalar: integer
+        constraints:
+          minimum: 1
+          maximum: 65535
+    - name: step
+      type:
+        scalar: float
+        constraints:
+          multipleOf: 0.1
+    - name: list
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: atomic
+        constraints:
+          minItems: 1
+          maxItems: 2
+    - name: map
+      type:
+        map:
+          elementType:
+            scalar: string
+        constraints:
+          maxProperties: 1
+`,
+	validObjects: []string{
+		`{"enum":"a"}`,
+		`{"numericEnum":1.0}`,
+		`{"numericEnum":2.5}`,
+		`{"name":"ab"}`,
+		`{"name":"abcd"}`,
+		`{"port":1}`,
+		`{"port":65535}`,
+		`{"step":0.3}`,
+		`{"step":2}`,
+		`{"list":["a"]}`,
+		`{"list":["a","b"]}`,
+		`{"map":{"a":"b"}}`,
+		`{"list":null,"map":null}`,
+	},
+	invalidObjects: []string{
+		`{"enum":"c"}`,
+		`{"numericEnum":3}`,
+		`{"name":"a"}`,
+		`{"name":"abcde"}`,
+		`{"name":"AB"}`,
+		`{"port":0}`,
+		`{"port":65536}`,
+		`{"step":0.35}`,
+		`{"list":[]}`,
+		`{"list":["a","b","c"]}`,
+		`{"map":{"a":"b","c":"d"}}`,
+	},
+}, {
+	name:         "preserve unknown fields",
+	rootTypeName: "crd",
+	schema: `types:
+- name: crd
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: spec
+      type:
+        struct:
+          fields:
+          - name: replicas
+            type:
+              scalar: integer
+          preserveUnknownFields: true
+`,
+	validObjects: []string{
+		`{"spec":{"replicas":1}}`,
+		`{"spec":{"replicas":1,"other":"a"}}`,
+		`{"spec":{"other":{"a":[1,2]},"more":null}}`,
+	},
+	invalidObjects: []string{
+		`{"other":"a"}`,
+		`{"spec":{"replicas":"a","other":"a"}}`,
+	},
+}, {
+	name:         "nested and defaulted keys",
+	rootTypeName: "service",
+	schema: `types:
+- name: service
+  struct:
+    fields:
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: servicePort
+          elementRelationship: associative
+          keys:
+          - port.number
+          - protocol
+- name: servicePort
+  struct:
+    fields:
+    - name: port
+      type:
+        struct:
+          fields:
+          - name: number
+            type:
+              scalar: integer
+          - name: name
+            type:
+              scalar: string
+    - name: protocol
+      type:
+        scalar: string
+      default: TCP
+    - name: target
+      type:
+        scalar: integer
+`,
+	validObjects: []string{
+		`{"ports":[{"port":{"number":80}}]}`,
+		`{"ports":[{"port":{"number":80}},{"port":{"number":80},"protocol":"UDP"}]}`,
+		`{"ports":[{"port":{"number":80,"name":"a"}},{"port":{"number":81,"name":"a"}}]}`,
+	},
+	invalidObjects: []string{
+		`{"ports":[{"protocol":"TCP"}]}`,
+		`{"ports":[{"port":{"name":"a"}}]}`,
+		`{"ports":[{"port":1}]}`,
+		`{"ports":[{"port":{"number":80}},{"port":{"number":80},"protocol":"TCP"}]}`,
+	},
+}, {
+	name:         "sets of atomic values",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: selectors
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: ranges
+      type:
+        list:
+          elementType:
+            list:
+              elementType:
+                scalar: integer
+              elementRelationship: atomic
+          elementRelationship: associative
+    - name: granular
+      type:
+        list:
+          elementType:
+            map:
+              elementType:
+                scalar: string
+          elementRelationship: associative
+`,
+	validObjects: []string{
+		`{"selectors":[{"a":"b"},{"a":"c"},{}]}`,
+		`{"selectors":[{"a":"b","c":"d"},{"c":"d"}]}`,
+		`{"ranges":[[1,2],[2,1],[]]}`,
+	},
+	invalidObjects: []string{
+		`{"selectors":[{"a":"b","c":"d"},{"c":"d","a":"b"}]}`,
+		`{"selectors":[{"a":"b"},null]}`,
+		`{"ranges":[[1,2],[1,2]]}`,
+		`{"granular":[{"a":"b"}]}`,
+	},
+}, {
+	name:         "map key types",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: ints
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: integer
+    - name: bools
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: boolean
+    - name: floats
+      type:
+        map:
+          elementType:
+            scalar: string
+          keyType: float
+`,
+	validObjects: []string{
+		`{"ints":{"1":"a","-2":"b","03":"c"}}`,
+		`{"bools":{"true":"a","false":"b"}}`,
+		`{"floats":{"1.5":"a","2":"b","1e3":"c"}}`,
+	},
+	invalidObjects: []string{
+		`{"ints":{"a":"a"}}`,
+		`{"ints":{"1.5":"a"}}`,
+		`{"ints":{"1":"a","01":"b"}}`,
+		`{"bools":{"yes":"a"}}`,
+		`{"bools":{"true":"a","True":"b"}}`,
+		`{"floats":{"NaN":"a"}}`,
+		`{"floats":{"1":"a","1.0":"b"}}`,
+	},
+}, {
+	name:         "renamed fields",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: replicas
+      type:
+        scalar: integer
+      formerNames:
+      - count
+    - name: ports
+      type:
+        list:
+          elementType:
+            namedType: port
+          elementRelationship: associative
+          keys:
+          - port
+- name: port
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer
+      formerNames:
+      - containerPort
+    - name: protocol
+      type:
+        scalar: string
+`,
+	validObjects: []string{
+		`{"replicas":1}`,
+		`{"count":1}`,
+		`{"ports":[{"containerPort":80},{"port":53,"protocol":"UDP"}]}`,
+	},
+	invalidObjects: []string{
+		`{"count":1,"replicas":2}`,
+		`{"count":"one"}`,
+		`{"ports":[{"containerPort":80,"port":80}]}`,
+		`{"ports":[{"containerPort":80},{"port":80}]}`,
+	},
+}, {
+	name:         "scalar formats",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: cpu
+      type:
+        scalar: string
+        constraints:
+          format: quantity
+    - name: timeout
+      type:
+        scalar: string
+        constraints:
+          format: duration
+    - name: created
+      type:
+        scalar: string
+        constraints:
+          format: date-time
+    - name: sizes
+      type:
+        list:
+          elementType:
+            scalar: string
+            constraints:
+              format: quantity
+          elementRelationship: associative
+`,
+	validObjects: []string{
+		`{"cpu":"500m","timeout":"1m30s","created":"2018-10-01T12:00:00Z"}`,
+		`{"sizes":["1Gi","512Mi"]}`,
+	},
+	invalidObjects: []string{
+		`{"cpu":"half"}`,
+		`{"timeout":"1 minute"}`,
+		`{"created":"2018-10-01"}`,
+		`{"sizes":["1Gi","1024Mi"]}`,
+	},
+}, {
+	name:         "scalar unions",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: port
+      type:
+        scalar: integer|string
+    - name: limit
+      type:
+        scalar: numeric|string
+    - name: flag
+      type:
+        scalar: boolean|string
+`,
+	validObjects: []string{
+		`{"port":80}`,
+		`{"port":"http"}`,
+		`{"port":80.0}`,
+		`{"limit":0.5}`,
+		`{"limit":"unlimited"}`,
+		`{"flag":true}`,
+		`{"flag":"auto"}`,
+	},
+	invalidObjects: []string{
+		`{"port":80.5}`,
+		`{"port":true}`,
+		`{"port":{"name":"http"}}`,
+		`{"limit":false}`,
+		`{"flag":1}`,
+	},
+}, {
+	name:         "positional lists",
+	rootTypeName: "root",
+	schema: `types:
+- name: root
+  struct:
+    fields:
+    - name: args
+      type:
+        list:
+          elementType:
+            scalar: string
+          elementRelationship: positional
+    - name: steps
+      type:
+        list:
+          elementType:
+            namedType: step
+          elementRelationship: positional
+- name: step
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+    - name: image
+      type:
+        scalar: string
+`,
+	validObjects: []string{
+		`{"args":["-v","-v"]}`,
+		`{"args":[]}`,
+		`{"steps":[{"name":"a"},{"name":"a","image":"b"},{}]}`,
+	},
+	invalidObjects: []string{
+		`{"args":[1]}`,
+		`{"args":{"a":"b"}}`,
+		`{"steps":[{"name":1}]}`,
+	},
 }}
 
 func (tt validationTestCase) test(t *testing.T) {
@@ -233,6 +736,9 @@ func (tt validationTestCase) test(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to unmarshal schema")
 	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("invalid schema: %v", err)
+	}
 
 	for i, v := range tt.validObjects {
 		v := v
@@ -276,3 +782,28 @@ func TestSchemaValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestConstraintErrorsPerViolation(t *testing.T) {
+	s := mustSchema(t, `types:
+- name: myStruct
+  struct:
+    fields:
+    - name: name
+      type:
+        scalar: string
+        constraints:
+          pattern: '^[a-z]+$'
+          maxLength: 2
+          enum: [ab, cd]
+`)
+	err := AsTypedUnvalidated(mustValue(t, `{"name":"ABC"}`), s, "myStruct").Validate()
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 validation errors, got %v", err)
+	}
+	for _, e := range errs {
+		if e.Path.String() != ".name" {
+			t.Errorf("expected error at .name, got %v", e)
+		}
+	}
+}
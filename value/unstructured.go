@@ -171,9 +171,9 @@ func (v *Value) ToUnstructured(preserveOrder bool) interface{} {
 		i := int64(*v.Int)
 		return i
 	case v.String != nil:
-		return *v.String
+		return string(*v.String)
 	case v.Boolean != nil:
-		return *v.Boolean
+		return bool(*v.Boolean)
 	case v.List != nil:
 		out := []interface{}{}
 		for _, item := range v.List.Items {
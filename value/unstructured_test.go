@@ -97,6 +97,12 @@ func runUnstructuredTestOrdered(t *testing.T, input []byte) {
 		t.Fatalf("unstructured rendered an unencodable output: %v", err)
 	}
 
+	if v2, err := FromUnstructured(encoded); err != nil {
+		t.Fatalf("failed to reinterpret (%v): %#v", err, encoded)
+	} else if !Equals(v, v2) {
+		t.Fatalf("From/To were not inverse: expected %v, got %v", v, v2)
+	}
+
 	if string(dcheck) != string(echeck) {
 		t.Fatalf("From/To were not inverse.\n\ndecoded: %#v\n\nencoded: %#v\n\ndecoded:\n%s\n\nencoded:\n%s", decoded, encoded, dcheck, echeck)
 	}
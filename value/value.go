@@ -18,6 +18,7 @@ package value
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -138,3 +139,69 @@ func (v Value) HumanReadable() string {
 		return "null"
 	}
 }
+
+// Canonical returns a string representation of v which is the same for any
+// two values for which Equals is true. Unlike HumanReadable, map fields are
+// sorted by name (and quoted). As in HumanReadable, an int and a float with
+// the same numeric value are not told apart.
+func (v Value) Canonical() string {
+	switch {
+	case v.List != nil:
+		strs := []string{}
+		for _, item := range v.List.Items {
+			strs = append(strs, item.Canonical())
+		}
+		return "[" + strings.Join(strs, ",") + "]"
+	case v.Map != nil:
+		strs := []string{}
+		for _, i := range v.Map.Items {
+			strs = append(strs, fmt.Sprintf("%q=%v", i.Name, i.Value.Canonical()))
+		}
+		sort.Strings(strs)
+		return "{" + strings.Join(strs, ";") + "}"
+	}
+	return v.HumanReadable()
+}
+
+// Equals returns true if lhs and rhs hold the same value. Maps are equal if
+// they have the same set of fields, regardless of order; lists must have the
+// same items in the same order. Ints and floats are never equal to each other;
+// callers that know the declared type of the values may want to be more
+// lenient.
+func Equals(lhs, rhs Value) bool {
+	switch {
+	case lhs.Float != nil:
+		return rhs.Float != nil && *lhs.Float == *rhs.Float
+	case lhs.Int != nil:
+		return rhs.Int != nil && *lhs.Int == *rhs.Int
+	case lhs.String != nil:
+		return rhs.String != nil && *lhs.String == *rhs.String
+	case lhs.Boolean != nil:
+		return rhs.Boolean != nil && *lhs.Boolean == *rhs.Boolean
+	case lhs.List != nil:
+		if rhs.List == nil || len(lhs.List.Items) != len(rhs.List.Items) {
+			return false
+		}
+		for i := range lhs.List.Items {
+			if !Equals(lhs.List.Items[i], rhs.List.Items[i]) {
+				return false
+			}
+		}
+		return true
+	case lhs.Map != nil:
+		if rhs.Map == nil || len(lhs.Map.Items) != len(rhs.Map.Items) {
+			return false
+		}
+		for _, lf := range lhs.Map.Items {
+			rf, ok := rhs.Map.Get(lf.Name)
+			if !ok || !Equals(lf.Value, rf.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return lhs.Null == rhs.Null &&
+			rhs.Float == nil && rhs.Int == nil && rhs.String == nil &&
+			rhs.Boolean == nil && rhs.List == nil && rhs.Map == nil
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package value
+
+import (
+	"testing"
+)
+
+func TestEquals(t *testing.T) {
+	cases := []struct {
+		lhs, rhs string
+		equal    bool
+	}{
+		{`1`, `1`, true},
+		{`1`, `2`, false},
+		{`1`, `1.0`, false},
+		{`1.5`, `1.5`, true},
+		{`"a"`, `"a"`, true},
+		{`"a"`, `a`, true},
+		{`"1"`, `1`, false},
+		{`true`, `true`, true},
+		{`true`, `false`, false},
+		{`null`, `null`, true},
+		{`null`, `{}`, false},
+		{`{}`, `{}`, true},
+		{`{"a":1,"b":2}`, `{"b":2,"a":1}`, true},
+		{`{"a":1,"b":2}`, `{"a":1}`, false},
+		{`{"a":1}`, `{"b":1}`, false},
+		{`{"a":[1,2]}`, `{"a":[1,2]}`, true},
+		{`{"a":[1,2]}`, `{"a":[2,1]}`, false},
+		{`{"a":[1,2]}`, `{"a":[1,2,3]}`, false},
+		{`{"x":[{"a":1,"b":{"c":2,"d":3}}]}`, `{"x":[{"b":{"d":3,"c":2},"a":1}]}`, true},
+	}
+	for _, tt := range cases {
+		lhs, err := FromYAML([]byte(tt.lhs))
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", tt.lhs, err)
+		}
+		rhs, err := FromYAML([]byte(tt.rhs))
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", tt.rhs, err)
+		}
+		// Populate the index of one side, it must not affect the result.
+		if lhs.Map != nil {
+			lhs.Map.Get("a")
+		}
+		if got := Equals(lhs, rhs); got != tt.equal {
+			t.Errorf("Equals(%v, %v) = %v, wanted %v", tt.lhs, tt.rhs, got, tt.equal)
+		}
+		if got := Equals(rhs, lhs); got != tt.equal {
+			t.Errorf("Equals(%v, %v) = %v, wanted %v", tt.rhs, tt.lhs, got, tt.equal)
+		}
+		if tt.equal && lhs.Canonical() != rhs.Canonical() {
+			t.Errorf("expected %v and %v to have the same canonical form, got %v and %v",
+				tt.lhs, tt.rhs, lhs.Canonical(), rhs.Canonical())
+		}
+	}
+}
+
+func TestCanonicalIsUnambiguous(t *testing.T) {
+	distinct := []string{
+		`{"a":"b;c"}`,
+		`{"a":"b","c":null}`,
+		`{"a;c":"b"}`,
+		`["a","b"]`,
+		`["a,b"]`,
+		`[["a"],"b"]`,
+		`{"a":{}}`,
+		`{"a":[]}`,
+	}
+	seen := map[string]string{}
+	for _, y := range distinct {
+		v, err := FromYAML([]byte(y))
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", y, err)
+		}
+		c := v.Canonical()
+		if other, ok := seen[c]; ok {
+			t.Errorf("%v and %v have the same canonical form %v", y, other, c)
+		}
+		seen[c] = y
+	}
+}